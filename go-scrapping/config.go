@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+	"github.com/NoxturneDev/hn-scrapper/pipeline"
+	"gopkg.in/yaml.v3"
+)
+
+// SiteConfig describes one site to scrape: where to start, how to paginate and
+// which CSS selectors to use when extracting items
+type SiteConfig struct {
+	Name       string            `json:"name" yaml:"name"`
+	Hosts      []string          `json:"hosts" yaml:"hosts"`
+	Seeds      []string          `json:"seeds" yaml:"seeds"`
+	Pagination *PaginationRule   `json:"pagination,omitempty" yaml:"pagination,omitempty"`
+	Selectors  extract.Selectors `json:"selectors" yaml:"selectors"`
+
+	// Sources add the pages listed by sitemaps, feeds or URL files, looked
+	// up again on every run
+	Sources []SourceConfig `json:"sources,omitempty" yaml:"sources,omitempty"`
+
+	// Schedule is a cron expression ("*/30 * * * *", "@hourly") used in
+	// daemon mode
+	Schedule string `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+
+	// Fetcher is "http" (the default) or "render" for pages that need their
+	// JavaScript run, see -render-url
+	Fetcher string `json:"fetcher,omitempty" yaml:"fetcher,omitempty"`
+}
+
+// Site fetcher settings
+const (
+	fetcherHTTP   = "http"
+	fetcherRender = "render"
+)
+
+// PaginationRule generates page URLs by substituting a page number into a
+// format string, e.g. "https://news.ycombinator.com/news?p=%d"
+type PaginationRule struct {
+	URL   string `json:"url" yaml:"url"`
+	Start int    `json:"start" yaml:"start"`
+	End   int    `json:"end" yaml:"end"`
+}
+
+// SourceConfig lists page URLs from one sitemap, feed or file. Exactly one of
+// Sitemap, Feed and File is set.
+type SourceConfig struct {
+	Sitemap string `json:"sitemap,omitempty" yaml:"sitemap,omitempty"` // sitemap.xml or sitemap index URL
+	Feed    string `json:"feed,omitempty" yaml:"feed,omitempty"`       // RSS or Atom feed URL
+	File    string `json:"file,omitempty" yaml:"file,omitempty"`       // local file, one URL per line
+
+	// Match keeps only URLs matching this regexp and Limit keeps the first
+	// Limit of those (0 = all)
+	Match string `json:"match,omitempty" yaml:"match,omitempty"`
+	Limit int    `json:"limit,omitempty" yaml:"limit,omitempty"`
+}
+
+// SitesConfig is the top-level structure of the -config file
+type SitesConfig struct {
+	Sites []SiteConfig `json:"sites" yaml:"sites"`
+
+	// Proxies and UserAgents add to the -proxy and -user-agent-pool flags
+	Proxies    fetch.ProxyConfig `json:"proxies,omitempty" yaml:"proxies,omitempty"`
+	UserAgents []string          `json:"user_agents,omitempty" yaml:"user_agents,omitempty"`
+
+	// Alerts notifies about new items matching a watchlist
+	Alerts pipeline.AlertConfig `json:"alerts,omitempty" yaml:"alerts,omitempty"`
+}
+
+// defaultSitesConfig returns the built-in Hacker News profile used when no
+// -config file is given
+func defaultSitesConfig() SitesConfig {
+	return SitesConfig{
+		Sites: []SiteConfig{
+			{
+				Name:  "hackernews",
+				Hosts: []string{"news.ycombinator.com"},
+				Seeds: []string{"https://news.ycombinator.com/"},
+				Pagination: &PaginationRule{
+					URL:   "https://news.ycombinator.com/news?p=%d",
+					Start: 2,
+					End:   30,
+				},
+				Selectors: extract.HackerNewsSelectors,
+			},
+		},
+	}
+}
+
+// Load the site config from a JSON or YAML file, chosen by file extension
+func loadSitesConfig(path string) (SitesConfig, error) {
+	var cfg SitesConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		return cfg, fmt.Errorf("unsupported config format %q (use .json, .yaml or .yml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c SitesConfig) validate() error {
+	if len(c.Sites) == 0 {
+		return fmt.Errorf("config defines no sites")
+	}
+	for i, site := range c.Sites {
+		if site.Name == "" {
+			return fmt.Errorf("site %d has no name", i)
+		}
+		if len(site.Seeds) == 0 && site.Pagination == nil && len(site.Sources) == 0 {
+			return fmt.Errorf("site %q has no seeds, pagination or sources", site.Name)
+		}
+		if site.Selectors.Item == "" {
+			return fmt.Errorf("site %q has no item selector", site.Name)
+		}
+		if p := site.Pagination; p != nil && (!strings.Contains(p.URL, "%d") || p.End < p.Start) {
+			return fmt.Errorf("site %q has an invalid pagination rule", site.Name)
+		}
+		if site.Fetcher != "" && site.Fetcher != fetcherHTTP && site.Fetcher != fetcherRender {
+			return fmt.Errorf("site %q has unknown fetcher %q", site.Name, site.Fetcher)
+		}
+		for j, src := range site.Sources {
+			if err := src.validate(); err != nil {
+				return fmt.Errorf("site %q source %d: %w", site.Name, j, err)
+			}
+		}
+		// URL files name no host, and every source URL outside the site's
+		// hosts is dropped
+		if len(site.hostsFor()) == 0 {
+			return fmt.Errorf("site %q needs hosts since no seed, pagination or sitemap/feed URL names one", site.Name)
+		}
+	}
+	return nil
+}
+
+// hostsFor returns the hosts a site's extractor applies to. Sites without an
+// explicit host list fall back to the hosts of their seed and pagination URLs.
+func (s SiteConfig) hostsFor() []string {
+	if len(s.Hosts) > 0 {
+		return s.Hosts
+	}
+
+	seen := make(map[string]bool)
+	var hosts []string
+	candidates := append([]string{}, s.Seeds...)
+	if s.Pagination != nil {
+		candidates = append(candidates, fmt.Sprintf(s.Pagination.URL, s.Pagination.Start))
+	}
+	for _, src := range s.Sources {
+		candidates = append(candidates, src.Sitemap, src.Feed)
+	}
+	for _, raw := range candidates {
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" || seen[u.Hostname()] {
+			continue
+		}
+		seen[u.Hostname()] = true
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
+}
+
+// pageURLs expands a site's seeds and pagination rule into the URLs to scrape
+func (s SiteConfig) pageURLs() []string {
+	urls := append([]string{}, s.Seeds...)
+	if p := s.Pagination; p != nil {
+		for i := p.Start; i <= p.End; i++ {
+			urls = append(urls, fmt.Sprintf(p.URL, i))
+		}
+	}
+	return urls
+}
+
+// newExtractorRegistry registers each site's selectors for its hosts
+func newExtractorRegistry(cfg SitesConfig) *extract.Registry {
+	r := extract.NewRegistry()
+	for _, site := range cfg.Sites {
+		extractor := extract.NewSelectorExtractor(site.Name, site.Selectors)
+		for _, host := range site.hostsFor() {
+			r.Register(host, extractor)
+		}
+	}
+	return r
+}
+
+// newFetcherRegistry registers render for the hosts of sites set to use it
+func newFetcherRegistry(cfg SitesConfig, render fetch.Fetcher) *fetch.Registry {
+	r := fetch.NewRegistry()
+	for _, site := range cfg.Sites {
+		if site.Fetcher != fetcherRender {
+			continue
+		}
+		for _, host := range site.hostsFor() {
+			r.Register(host, render)
+		}
+	}
+	return r
+}
+
+// hosts returns the hosts of every site
+func (c SitesConfig) hosts() []string {
+	var hosts []string
+	for _, site := range c.Sites {
+		hosts = append(hosts, site.hostsFor()...)
+	}
+	return hosts
+}
+
+// needsRenderer reports whether any site is set to use the render fetcher
+func (c SitesConfig) needsRenderer() bool {
+	for _, site := range c.Sites {
+		if site.Fetcher == fetcherRender {
+			return true
+		}
+	}
+	return false
+}
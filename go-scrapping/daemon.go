@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/pipeline"
+	"github.com/robfig/cron/v3"
+)
+
+// runDaemon scrapes each site on its cron schedule until ctx is canceled.
+// Only one run happens at a time since runs share the crawl queue, so a tick
+// that fires while another site is running waits its turn. A tick for a site
+// whose previous run is still running or waiting is skipped.
+func runDaemon(ctx context.Context, db *sql.DB, client *http.Client, config Config, logger *slog.Logger) error {
+	scheduler := cron.New()
+	runs := newRunQueue()
+
+	scheduled := 0
+	for _, site := range config.Sites.Sites {
+		spec := site.Schedule
+		if spec == "" {
+			spec = config.DefaultSchedule
+		}
+		if spec == "" {
+			logger.Warn("Site has no schedule, it will not be scraped in daemon mode", "site", site.Name)
+			continue
+		}
+
+		_, err := scheduler.AddFunc(spec, func() {
+			queued := runs.Run(site.Name, func() {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Info("Starting scheduled run", "site", site.Name)
+				urls := siteURLs(ctx, site, client, config.run.Fetch, logger)
+				if _, err := scrapeSites(ctx, []SiteConfig{site}, urls, db, client, config.run, logger); err != nil {
+					logger.Error("Scheduled run failed", "site", site.Name, "error", err)
+				}
+			})
+			if !queued {
+				logger.Warn("Skipping scheduled run, previous run of this site still in progress", "site", site.Name)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("invalid schedule %q for site %q: %w", spec, site.Name, err)
+		}
+		logger.Info("Scheduled site", "site", site.Name, "schedule", spec)
+		scheduled++
+	}
+	if scheduled == 0 {
+		return fmt.Errorf("no site has a schedule, set one in the config or with -schedule")
+	}
+
+	scheduler.Start()
+	<-ctx.Done()
+
+	// Stop firing new ticks and wait for a run in progress to drain
+	logger.Info("Stopping scheduler, waiting for the current run to finish")
+	<-scheduler.Stop().Done()
+	return nil
+}
+
+// runQueue runs scheduled scrapes one at a time, in the order their ticks
+// fired. Each site has at most one run running or waiting.
+type runQueue struct {
+	mu      sync.Mutex
+	running bool
+	waiting []chan struct{} // closed in order to hand the next run its turn
+	pending map[string]bool // sites with a run queued or in progress
+}
+
+func newRunQueue() *runQueue {
+	return &runQueue{pending: make(map[string]bool)}
+}
+
+// Run waits for the runs ahead of it and then calls fn. It returns false
+// without calling fn if site already has a run queued or in progress.
+func (q *runQueue) Run(site string, fn func()) bool {
+	q.mu.Lock()
+	if q.pending[site] {
+		q.mu.Unlock()
+		return false
+	}
+	q.pending[site] = true
+	var turn chan struct{}
+	if q.running {
+		turn = make(chan struct{})
+		q.waiting = append(q.waiting, turn)
+	}
+	q.running = true
+	q.mu.Unlock()
+
+	if turn != nil {
+		<-turn
+	}
+	defer q.done(site)
+	fn()
+	return true
+}
+
+// done ends site's run and starts the longest waiting one, if any
+func (q *runQueue) done(site string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.pending, site)
+	if len(q.waiting) == 0 {
+		q.running = false
+		return
+	}
+	close(q.waiting[0])
+	q.waiting = q.waiting[1:]
+}
+
+// scrapeSites runs ProcessURLs for the given sites and records the run and
+// its report in the runs table
+func scrapeSites(ctx context.Context, sites []SiteConfig, urls []string, db *sql.DB, client *http.Client, config pipeline.Config, logger *slog.Logger) (pipeline.RunSummary, error) {
+	names := make([]string, len(sites))
+	for i, site := range sites {
+		names[i] = site.Name
+	}
+
+	runID, err := pipeline.StartRun(db, names, time.Now())
+	if err != nil {
+		return pipeline.RunSummary{}, err
+	}
+
+	config.RunID = runID
+	summary, runErr := pipeline.ProcessURLs(ctx, urls, db, client, config, logger.With("run_id", runID))
+	if err := pipeline.FinishRun(db, runID, summary, runErr, ctx.Err() != nil); err != nil {
+		logger.Error("Failed to record run", "run_id", runID, "error", err)
+	}
+	return summary, runErr
+}
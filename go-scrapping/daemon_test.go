@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunQueueSerializesSitesWithoutDroppingThem(t *testing.T) {
+	q := newRunQueue()
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	var order []string
+	var mu sync.Mutex
+	record := func(site string) {
+		mu.Lock()
+		order = append(order, site)
+		mu.Unlock()
+	}
+
+	// hackernews is running when lobsters' tick fires at the same minute
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.Run("hackernews", func() {
+			close(started)
+			<-release
+			record("hackernews")
+		})
+	}()
+	<-started
+
+	wg.Add(1)
+	lobstersRan := false
+	go func() {
+		defer wg.Done()
+		lobstersRan = q.Run("lobsters", func() { record("lobsters") })
+	}()
+
+	// A second hackernews tick while its run is in progress is skipped
+	if q.Run("hackernews", func() { t.Error("ran hackernews twice at once") }) {
+		t.Error("second hackernews tick was not skipped")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	if len(order) != 0 {
+		t.Errorf("lobsters ran alongside hackernews: %v", order)
+	}
+	mu.Unlock()
+
+	close(release)
+	wg.Wait()
+	if !lobstersRan || len(order) != 2 || order[0] != "hackernews" || order[1] != "lobsters" {
+		t.Errorf("ran %v, want hackernews then lobsters", order)
+	}
+}
+
+func TestRunQueueIsFIFO(t *testing.T) {
+	q := newRunQueue()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	waiting := func() int {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return len(q.waiting)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var order []string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.Run("first", func() {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+
+	// Queue the others one at a time, so their ticks fire in a known order
+	sites := []string{"a", "b", "c", "d"}
+	for i, site := range sites {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Run(site, func() {
+				mu.Lock()
+				order = append(order, site)
+				mu.Unlock()
+			})
+		}()
+		for waiting() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+	if len(order) != len(sites) {
+		t.Fatalf("ran %v, want %v", order, sites)
+	}
+	for i := range sites {
+		if order[i] != sites[i] {
+			t.Errorf("ran %v, want %v", order, sites)
+			break
+		}
+	}
+}
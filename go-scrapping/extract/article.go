@@ -0,0 +1,102 @@
+package extract
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// Article is the readable content of a page a scraped item links to
+type Article struct {
+	URL         string
+	FinalURL    string
+	Title       string
+	Author      string
+	PublishedAt string // as found on the page, usually RFC 3339
+	Description string
+	SiteName    string
+	Image       string
+	Content     string
+	WordCount   int
+	Meta        map[string]string // every <meta> name/property and its content
+}
+
+// ExtractArticle pulls metadata from <meta> tags and the main text from the
+// element holding the most paragraph text
+func ExtractArticle(doc *goquery.Document) *Article {
+	a := &Article{Meta: make(map[string]string)}
+
+	doc.Find("meta").Each(func(i int, s *goquery.Selection) {
+		name := s.AttrOr("property", s.AttrOr("name", s.AttrOr("itemprop", "")))
+		content := strings.TrimSpace(s.AttrOr("content", ""))
+		if name != "" && content != "" {
+			if _, ok := a.Meta[strings.ToLower(name)]; !ok {
+				a.Meta[strings.ToLower(name)] = content
+			}
+		}
+	})
+	meta := func(names ...string) string {
+		for _, name := range names {
+			if v := a.Meta[name]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	a.Title = meta("og:title", "twitter:title")
+	if a.Title == "" {
+		a.Title = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+	a.Description = meta("og:description", "description", "twitter:description")
+	a.SiteName = meta("og:site_name", "application-name")
+	a.Image = meta("og:image", "twitter:image")
+	a.PublishedAt = meta("article:published_time", "datepublished", "date", "dc.date")
+	if a.PublishedAt == "" {
+		a.PublishedAt = doc.Find("time[datetime]").First().AttrOr("datetime", "")
+	}
+	a.Author = meta("author", "article:author", "dc.creator", "twitter:creator")
+	if a.Author == "" {
+		a.Author = strings.TrimSpace(doc.Find(`[rel="author"], [itemprop="author"], .author, .byline`).First().Text())
+	}
+
+	a.Content = mainText(doc)
+	a.WordCount = len(strings.Fields(a.Content))
+	return a
+}
+
+// mainText finds the container with the most paragraph text, ignoring page
+// chrome, and returns its paragraphs separated by blank lines
+func mainText(doc *goquery.Document) string {
+	doc.Find("script, style, noscript, nav, header, footer, aside, form, iframe").Remove()
+
+	scores := make(map[*html.Node]int)
+	var best *html.Node
+	doc.Find("p").Each(func(i int, p *goquery.Selection) {
+		text := strings.TrimSpace(p.Text())
+		if len(text) < 25 {
+			return
+		}
+		parent := p.Parent()
+		if parent.Length() == 0 {
+			return
+		}
+		node := parent.Get(0)
+		scores[node] += len(text)
+		if scores[node] > scores[best] {
+			best = node
+		}
+	})
+	if best == nil {
+		return ""
+	}
+
+	var paragraphs []string
+	doc.FindNodes(best).Children().Filter("p, h2, h3, h4, blockquote, pre, ul, ol").Each(func(i int, s *goquery.Selection) {
+		if text := strings.Join(strings.Fields(s.Text()), " "); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	})
+	return strings.Join(paragraphs, "\n\n")
+}
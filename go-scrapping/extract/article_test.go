@@ -0,0 +1,59 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const articlePage = `<html><head>
+<title>Fallback title | Blog</title>
+<meta property="og:title" content="Why SQLite is enough">
+<meta property="og:site_name" content="Example Blog">
+<meta property="og:image" content="https://blog.example/cover.png">
+<meta name="description" content="A short case for SQLite.">
+<meta name="author" content="Ada Lovelace">
+<meta property="article:published_time" content="2024-05-01T10:00:00Z">
+</head><body>
+<header><p>Subscribe to our newsletter for more posts like this one!</p></header>
+<nav><a href="/">Home</a></nav>
+<article>
+  <h2>Introduction</h2>
+  <p>SQLite runs in-process and needs no server, which keeps deployments simple.</p>
+  <p>Most small services never outgrow a single file database on local disk.</p>
+  <div class="share"><p>Share</p></div>
+</article>
+<footer><p>Copyright 2024 Example Blog, all rights reserved worldwide.</p></footer>
+</body></html>`
+
+func TestExtractArticle(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(articlePage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := ExtractArticle(doc)
+
+	checks := []struct{ field, got, want string }{
+		{"title", a.Title, "Why SQLite is enough"},
+		{"author", a.Author, "Ada Lovelace"},
+		{"published_at", a.PublishedAt, "2024-05-01T10:00:00Z"},
+		{"description", a.Description, "A short case for SQLite."},
+		{"site_name", a.SiteName, "Example Blog"},
+		{"image", a.Image, "https://blog.example/cover.png"},
+		{"content", a.Content, "Introduction\n\n" +
+			"SQLite runs in-process and needs no server, which keeps deployments simple.\n\n" +
+			"Most small services never outgrow a single file database on local disk."},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %q, want %q", c.field, c.got, c.want)
+		}
+	}
+	if a.WordCount != 24 {
+		t.Errorf("word count = %d, want 24", a.WordCount)
+	}
+	if a.Meta["og:title"] != "Why SQLite is enough" {
+		t.Errorf("meta = %v, want og:title recorded", a.Meta)
+	}
+}
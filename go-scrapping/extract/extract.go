@@ -0,0 +1,238 @@
+// Package extract turns parsed pages into scraped items using per-site CSS
+// selectors
+package extract
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Item is one entry scraped from a listing page
+type Item struct {
+	Site   string
+	Title  string
+	URL    string
+	Fields map[string]string
+
+	// Listing position and engagement, for sites whose selectors capture
+	// them. Zero when unknown.
+	ItemID   string
+	Rank     int
+	Points   int
+	Comments int
+}
+
+// Selectors holds the CSS selectors used to extract items from a page.
+// Title, Link and Fields are evaluated relative to each Item match. An empty
+// Title uses the item element itself and an empty Link uses the title element.
+// Field selectors may end in "@attr" to read an attribute instead of the text.
+//
+// ID, Rank, Points and Comments use the field syntax too and are searched in
+// the item plus, when Subtext is set, the sibling right after it if it
+// matches Subtext (HN keeps the score and comment count in the next row).
+// The first number in the text is used for Rank, Points and Comments.
+type Selectors struct {
+	Item   string            `json:"item" yaml:"item"`
+	Title  string            `json:"title" yaml:"title"`
+	Link   string            `json:"link,omitempty" yaml:"link,omitempty"`
+	Fields map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+
+	Subtext  string `json:"subtext,omitempty" yaml:"subtext,omitempty"`
+	ID       string `json:"id,omitempty" yaml:"id,omitempty"`
+	Rank     string `json:"rank,omitempty" yaml:"rank,omitempty"`
+	Points   string `json:"points,omitempty" yaml:"points,omitempty"`
+	Comments string `json:"comments,omitempty" yaml:"comments,omitempty"`
+}
+
+// HackerNewsSelectors extract stories from HN listing pages along with their
+// rank, points and comment count
+var HackerNewsSelectors = Selectors{
+	Item:     "tr.athing",
+	Title:    ".titleline > a",
+	Subtext:  "tr",
+	ID:       "@id",
+	Rank:     ".rank",
+	Points:   ".score",
+	Comments: ".subline > a:last-child",
+}
+
+// Extractor pulls scraped items out of a parsed page
+type Extractor interface {
+	Extract(doc *goquery.Document, pageURL *url.URL) []Item
+}
+
+// RankTracker is implemented by extractors that capture listing positions.
+// Pages of ranked sites are extracted even when unchanged since the last
+// scrape, so every run has a complete rank snapshot.
+type RankTracker interface {
+	TracksRank() bool
+}
+
+// SelectorExtractor extracts items using a site's configured CSS selectors
+type SelectorExtractor struct {
+	site      string
+	selectors Selectors
+}
+
+func NewSelectorExtractor(site string, selectors Selectors) *SelectorExtractor {
+	return &SelectorExtractor{site: site, selectors: selectors}
+}
+
+// TracksRank reports whether the selectors capture each item's rank
+func (e *SelectorExtractor) TracksRank() bool {
+	return e.selectors.Rank != ""
+}
+
+func (e *SelectorExtractor) Extract(doc *goquery.Document, pageURL *url.URL) []Item {
+	var items []Item
+
+	doc.Find(e.selectors.Item).Each(func(i int, s *goquery.Selection) {
+		titleSel := s
+		if e.selectors.Title != "" {
+			titleSel = s.Find(e.selectors.Title).First()
+		}
+		linkSel := titleSel
+		if e.selectors.Link != "" {
+			linkSel = s.Find(e.selectors.Link).First()
+		}
+
+		title := strings.TrimSpace(titleSel.Text())
+		href, exists := linkSel.Attr("href")
+		if !exists || title == "" {
+			return
+		}
+
+		item := Item{
+			Site:  e.site,
+			Title: title,
+			URL:   resolveURL(pageURL, href),
+		}
+		// Metadata may live in the row after the item
+		scope := s
+		if e.selectors.Subtext != "" {
+			scope = s.AddSelection(s.NextFiltered(e.selectors.Subtext))
+		}
+		if e.selectors.ID != "" {
+			item.ItemID = extractField(scope, e.selectors.ID)
+		}
+		if e.selectors.Rank != "" {
+			item.Rank = parseCount(extractField(scope, e.selectors.Rank))
+		}
+		if e.selectors.Points != "" {
+			item.Points = parseCount(extractField(scope, e.selectors.Points))
+		}
+		if e.selectors.Comments != "" {
+			item.Comments = parseCount(extractField(scope, e.selectors.Comments))
+		}
+
+		if len(e.selectors.Fields) > 0 {
+			item.Fields = make(map[string]string, len(e.selectors.Fields))
+			for name, selector := range e.selectors.Fields {
+				item.Fields[name] = extractField(s, selector)
+			}
+		}
+		items = append(items, item)
+	})
+
+	return items
+}
+
+// extractField evaluates a field selector against an item. A trailing "@attr"
+// reads that attribute instead of the element text.
+func extractField(s *goquery.Selection, selector string) string {
+	attr := ""
+	if i := strings.LastIndex(selector, "@"); i >= 0 {
+		selector, attr = selector[:i], selector[i+1:]
+	}
+
+	sel := s
+	if selector != "" {
+		sel = s.Find(selector).First()
+	}
+	if attr != "" {
+		value, _ := sel.Attr(attr)
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(sel.Text())
+}
+
+// parseCount returns the first number in text such as "12." or
+// "1,345 points", or 0 when there is none ("discuss")
+func parseCount(text string) int {
+	start := strings.IndexFunc(text, unicode.IsDigit)
+	if start < 0 {
+		return 0
+	}
+	var digits strings.Builder
+	for _, r := range text[start:] {
+		if r == ',' {
+			continue
+		}
+		if !unicode.IsDigit(r) {
+			break
+		}
+		digits.WriteRune(r)
+	}
+	n, _ := strconv.Atoi(digits.String())
+	return n
+}
+
+// resolveURL makes href absolute relative to the page it was found on
+func resolveURL(base *url.URL, href string) string {
+	ref, err := url.Parse(href)
+	if err != nil || base == nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// Registry picks an extractor for a URL based on its host
+type Registry struct {
+	byHost map[string]Extractor
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byHost: make(map[string]Extractor)}
+}
+
+// Register uses e for pages on host
+func (r *Registry) Register(host string, e Extractor) {
+	r.byHost[strings.ToLower(host)] = e
+}
+
+// Lookup returns the extractor registered for the URL's host, or nil
+func (r *Registry) Lookup(u *url.URL) Extractor {
+	return r.byHost[strings.ToLower(u.Hostname())]
+}
+
+// Links returns the absolute http(s) links on a page that point to the same
+// host, with fragments removed
+func Links(doc *goquery.Document, pageURL *url.URL) []string {
+	seen := make(map[string]bool)
+	var links []string
+
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			return
+		}
+		u := pageURL.ResolveReference(ref)
+		if (u.Scheme != "http" && u.Scheme != "https") || !strings.EqualFold(u.Hostname(), pageURL.Hostname()) {
+			return
+		}
+		u.Fragment = ""
+		u.RawFragment = ""
+
+		link := u.String()
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	})
+	return links
+}
@@ -0,0 +1,54 @@
+package extract
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// hnListing mirrors the markup of two stories on an HN listing page: a job
+// ad without a score and a regular story
+const hnListing = `<table>
+<tr class="athing" id="41000001">
+  <td><span class="rank">31.</span></td>
+  <td><span class="titleline"><a href="https://jobs.example.com/">Acme is hiring</a></span></td>
+</tr>
+<tr><td class="subtext"><span class="subline"><span class="age"><a href="item?id=41000001">2 hours ago</a></span></span></td></tr>
+<tr class="spacer"></tr>
+<tr class="athing" id="41000002">
+  <td><span class="rank">32.</span></td>
+  <td><span class="titleline"><a href="item?id=41000002">Ask HN: Something</a> <span class="sitebit"><a href="from?site=x">x</a></span></span></td>
+</tr>
+<tr><td class="subtext"><span class="subline">
+  <span class="score">1,234 points</span> by <a class="hnuser">pg</a>
+  <span class="age"><a href="item?id=41000002">3 hours ago</a></span> |
+  <a href="hide?id=41000002">hide</a> | <a href="item?id=41000002">567&nbsp;comments</a>
+</span></td></tr>
+</table>`
+
+func TestSelectorExtractorCapturesRankAndCounts(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(hnListing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageURL, _ := url.Parse("https://news.ycombinator.com/news?p=2")
+
+	extractor := NewSelectorExtractor("hackernews", HackerNewsSelectors)
+	items := extractor.Extract(doc, pageURL)
+
+	want := []Item{
+		{Site: "hackernews", Title: "Acme is hiring", URL: "https://jobs.example.com/", ItemID: "41000001", Rank: 31},
+		{Site: "hackernews", Title: "Ask HN: Something", URL: "https://news.ycombinator.com/item?id=41000002", ItemID: "41000002", Rank: 32, Points: 1234, Comments: 567},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(items), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(items[i], want[i]) {
+			t.Errorf("item %d = %+v, want %+v", i, items[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files from the current extractor output")
+
+// hnFixtures holds recorded HN pages, see `scraper record`
+const hnFixtures = "../testdata/hn"
+
+// TestHackerNewsGolden extracts every recorded HN page and compares the items
+// with its .golden.json file. Run with -update after recording new pages or
+// changing the selectors on purpose.
+func TestHackerNewsGolden(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join(hnFixtures, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages map[string]string
+	if err := json.Unmarshal(data, &pages); err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("no recorded pages in the manifest")
+	}
+
+	extractor := NewSelectorExtractor("hackernews", HackerNewsSelectors)
+	for name, pageURL := range pages {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join(hnFixtures, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			doc, err := goquery.NewDocumentFromReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := url.Parse(pageURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := json.MarshalIndent(extractor.Extract(doc, u), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join(hnFixtures, strings.TrimSuffix(name, ".html")+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("items differ from %s, run go test -update if the change is intended\ngot:\n%s", golden, got)
+			}
+		})
+	}
+}
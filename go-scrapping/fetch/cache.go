@@ -0,0 +1,219 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheStatusHeader is set on responses served by CachingTransport. Its value
+// is one of the cacheFresh or cacheRevalidated constants.
+const cacheStatusHeader = "X-Scraper-Cache"
+
+const (
+	cacheFresh       = "fresh"       // served from disk without a request
+	cacheRevalidated = "revalidated" // server answered 304 Not Modified
+)
+
+// Cache stores GET responses on disk, one JSON file per URL
+type Cache struct {
+	dir    string
+	maxAge time.Duration // entries younger than this are served without revalidation
+}
+
+type cacheEntry struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+func NewCache(dir string, maxAge time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	return &Cache{dir: dir, maxAge: maxAge}, nil
+}
+
+func (c *Cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load returns the cached entry for url, or nil if there is none
+func (c *Cache) load(url string) (*cacheEntry, error) {
+	data, err := os.ReadFile(c.path(url))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		// A corrupt entry is just a miss
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// store writes an entry atomically so concurrent readers never see a partial file
+func (c *Cache) store(entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(entry.URL))
+}
+
+// Purge removes every cached entry
+func (c *Cache) Purge() (int, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil {
+			return 0, fmt.Errorf("failed to purge cache: %w", err)
+		}
+	}
+	return len(files), nil
+}
+
+// response builds a 200 response for req from a cached entry
+func (e *cacheEntry) response(req *http.Request, status string) *http.Response {
+	header := e.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set(cacheStatusHeader, status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// CachingTransport serves GET requests from a Cache, revalidating stale
+// entries with If-None-Match / If-Modified-Since
+type CachingTransport struct {
+	Base  http.RoundTripper
+	Cache *Cache
+}
+
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.Base.RoundTrip(req)
+	}
+
+	url := req.URL.String()
+	entry, err := t.Cache.load(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	if entry != nil && t.Cache.maxAge > 0 && time.Since(entry.StoredAt) < t.Cache.maxAge {
+		return entry.response(req, cacheFresh), nil
+	}
+
+	// Ask the server whether our copy is still current
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		entry.StoredAt = time.Now()
+		if err := t.Cache.store(entry); err != nil {
+			return nil, fmt.Errorf("failed to write cache: %w", err)
+		}
+		return entry.response(req, cacheRevalidated), nil
+	}
+
+	if resp.StatusCode != http.StatusOK || !t.cacheable(resp) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	entry = &cacheEntry{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		StoredAt:   time.Now(),
+	}
+	if err := t.Cache.store(entry); err != nil {
+		return nil, fmt.Errorf("failed to write cache: %w", err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// cacheable reports whether a 200 response is worth storing: it must not be
+// marked no-store and must carry a validator, unless -cache-max-age lets us
+// reuse it without revalidation
+func (t *CachingTransport) cacheable(resp *http.Response) bool {
+	if strings.Contains(strings.ToLower(resp.Header.Get("Cache-Control")), "no-store") {
+		return false
+	}
+	if t.Cache.maxAge > 0 {
+		return true
+	}
+	return resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+// unchangedSinceCached reports whether a response was served from the cache
+// because the page hasn't changed since it was last scraped
+func unchangedSinceCached(resp *http.Response) bool {
+	status := resp.Header.Get(cacheStatusHeader)
+	return status == cacheFresh || status == cacheRevalidated
+}
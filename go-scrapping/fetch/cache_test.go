@@ -0,0 +1,174 @@
+package fetch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cacheServer serves a fixed page with the given headers, answering 304 when
+// a request's validators match them, and counts requests and 304 answers
+type cacheServer struct {
+	*httptest.Server
+	requests    atomic.Int32
+	notModified atomic.Int32
+}
+
+func newCacheServer(t *testing.T, header http.Header) *cacheServer {
+	t.Helper()
+	s := &cacheServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		etag, lastModified := header.Get("ETag"), header.Get("Last-Modified")
+		if (etag != "" && r.Header.Get("If-None-Match") == etag) ||
+			(lastModified != "" && r.Header.Get("If-Modified-Since") == lastModified) {
+			s.notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "<html>page</html>")
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newCachingClient(t *testing.T, maxAge time.Duration) (*http.Client, *Cache) {
+	t.Helper()
+	cache, err := NewCache(t.TempDir(), maxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Transport: &CachingTransport{Base: http.DefaultTransport, Cache: cache}}, cache
+}
+
+// getCached fetches url and returns the body and the cache status header
+func getCached(t *testing.T, client *http.Client, url string) (string, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	return string(body), resp.Header.Get(cacheStatusHeader)
+}
+
+func TestCachingTransportRevalidates(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"etag", http.Header{"Etag": {`"v1"`}}},
+		{"last-modified", http.Header{"Last-Modified": {"Tue, 02 Jan 2024 03:04:05 GMT"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCacheServer(t, tt.header)
+			client, _ := newCachingClient(t, 0)
+
+			if body, status := getCached(t, client, srv.URL); body != "<html>page</html>" || status != "" {
+				t.Fatalf("first fetch = %q, %q; want the page from the server", body, status)
+			}
+
+			// The stored copy is sent again after the server answers 304
+			body, status := getCached(t, client, srv.URL)
+			if body != "<html>page</html>" || status != cacheRevalidated {
+				t.Errorf("second fetch = %q, %q; want the cached page, %q", body, status, cacheRevalidated)
+			}
+			if n := srv.notModified.Load(); n != 1 {
+				t.Errorf("server answered 304 %d times, want 1", n)
+			}
+		})
+	}
+}
+
+func TestCachingTransportServesFreshEntries(t *testing.T) {
+	srv := newCacheServer(t, nil)
+	client, cache := newCachingClient(t, time.Hour)
+
+	// Without validators a page is still cached while younger than maxAge
+	getCached(t, client, srv.URL)
+	if _, status := getCached(t, client, srv.URL); status != cacheFresh {
+		t.Errorf("second fetch status = %q, want %q", status, cacheFresh)
+	}
+	if n := srv.requests.Load(); n != 1 {
+		t.Errorf("server got %d requests, want 1", n)
+	}
+
+	// Once it is older, the server is asked again
+	entry, err := cache.load(srv.URL)
+	if err != nil || entry == nil {
+		t.Fatalf("no cache entry: %v", err)
+	}
+	entry.StoredAt = time.Now().Add(-2 * time.Hour)
+	if err := cache.store(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, status := getCached(t, client, srv.URL); status != "" {
+		t.Errorf("expired entry served with status %q, want a new fetch", status)
+	}
+	if n := srv.requests.Load(); n != 2 {
+		t.Errorf("server got %d requests, want 2", n)
+	}
+}
+
+func TestCachingTransportSkipsUncacheable(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		header http.Header
+	}{
+		{"no-store", time.Hour, http.Header{"Etag": {`"v1"`}, "Cache-Control": {"private, no-store"}}},
+		{"no validator", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCacheServer(t, tt.header)
+			client, cache := newCachingClient(t, tt.maxAge)
+
+			for i := 0; i < 2; i++ {
+				if _, status := getCached(t, client, srv.URL); status != "" {
+					t.Errorf("fetch %d served from the cache (%q)", i, status)
+				}
+			}
+			if n := srv.requests.Load(); n != 2 {
+				t.Errorf("server got %d requests, want 2", n)
+			}
+			if entry, _ := cache.load(srv.URL); entry != nil {
+				t.Error("response was stored")
+			}
+		})
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	srv := newCacheServer(t, http.Header{"Etag": {`"v1"`}})
+	client, cache := newCachingClient(t, time.Hour)
+
+	getCached(t, client, srv.URL)
+	getCached(t, client, srv.URL+"/other")
+	n, err := cache.Purge()
+	if err != nil || n != 2 {
+		t.Fatalf("Purge() = %d, %v; want 2 entries removed", n, err)
+	}
+
+	// Nothing is served from disk after a purge
+	if _, status := getCached(t, client, srv.URL); status != "" {
+		t.Errorf("fetch after purge served from the cache (%q)", status)
+	}
+	if n := srv.requests.Load(); n != 3 {
+		t.Errorf("server got %d requests, want 3", n)
+	}
+}
@@ -0,0 +1,92 @@
+// Package fetch retrieves pages politely: retries with backoff, per-host rate
+// limits, robots.txt, an on-disk HTTP cache and rotating proxies
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Fetcher retrieves the HTML of a page
+type Fetcher interface {
+	// Fetch returns the page body, which the caller must close. Attempts is
+	// set in the result even when the fetch fails.
+	Fetch(ctx context.Context, pageURL string) (Result, error)
+}
+
+// Result is a fetched page
+type Result struct {
+	StatusCode int
+	Body       io.ReadCloser
+	Attempts   int
+	Unchanged  bool // served from the HTTP cache, nothing new to extract
+}
+
+// HTTPFetcher is the default fetcher: a plain GET through the shared client,
+// with retries
+type HTTPFetcher struct {
+	Client  *http.Client
+	Options Options
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, pageURL string) (Result, error) {
+	return fetchResult(Get(ctx, pageURL, f.Client, f.Options))
+}
+
+// RenderFetcher asks a local rendering service (Splash, Prerender,
+// Browserless and the like) for the HTML of a page after its JavaScript ran.
+// Endpoint is a URL template where "{url}" is replaced with the query-escaped
+// page URL, e.g. "http://localhost:8050/render.html?url={url}&wait=1".
+// Requests go through the shared client, so the service is rate limited and
+// cached like any other host.
+type RenderFetcher struct {
+	Endpoint string
+	Client   *http.Client
+	Options  Options
+}
+
+func (f *RenderFetcher) Fetch(ctx context.Context, pageURL string) (Result, error) {
+	return fetchResult(Get(ctx, f.renderURL(pageURL), f.Client, f.Options))
+}
+
+func (f *RenderFetcher) renderURL(pageURL string) string {
+	return strings.ReplaceAll(f.Endpoint, "{url}", url.QueryEscape(pageURL))
+}
+
+func fetchResult(resp *http.Response, attempts int, err error) (Result, error) {
+	result := Result{Attempts: attempts}
+	if err != nil {
+		return result, err
+	}
+	result.StatusCode = resp.StatusCode
+	result.Body = resp.Body
+	result.Unchanged = unchangedSinceCached(resp)
+	return result, nil
+}
+
+// Registry holds the fetchers of sites that don't use the default HTTP
+// fetcher, by host
+type Registry struct {
+	byHost map[string]Fetcher
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byHost: make(map[string]Fetcher)}
+}
+
+// Register uses f for pages on host
+func (r *Registry) Register(host string, f Fetcher) {
+	r.byHost[strings.ToLower(host)] = f
+}
+
+// Lookup returns the fetcher configured for the URL's host, or nil for the
+// default one. A nil registry has no overrides.
+func (r *Registry) Lookup(u *url.URL) Fetcher {
+	if r == nil {
+		return nil
+	}
+	return r.byHost[strings.ToLower(u.Hostname())]
+}
@@ -0,0 +1,99 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRenderFetcherURL(t *testing.T) {
+	f := &RenderFetcher{Endpoint: "http://localhost:8050/render.html?url={url}&wait=1"}
+	got := f.renderURL("https://spa.example/list?page=2&sort=new")
+
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target := u.Query().Get("url"); target != "https://spa.example/list?page=2&sort=new" {
+		t.Errorf("url parameter = %q", target)
+	}
+	if u.Query().Get("wait") != "1" {
+		t.Errorf("lost the endpoint's own parameters: %s", got)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"503", &StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"429", &StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"501", &StatusError{StatusCode: http.StatusNotImplemented}, false},
+		{"404", &StatusError{StatusCode: http.StatusNotFound}, false},
+		{"reset", fmt.Errorf("failed to fetch URL: %w", syscall.ECONNRESET), true},
+		{"timeout", &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, true},
+		{"nxdomain", fmt.Errorf("failed to fetch URL: %w", &net.DNSError{Err: "no such host", Name: "nope.example", IsNotFound: true}), false},
+		{"bad certificate", fmt.Errorf("failed to fetch URL: %w", &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), false},
+	}
+	for _, tt := range tests {
+		if got := shouldRetry(context.Background(), tt.err); got != tt.want {
+			t.Errorf("%s: shouldRetry() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{"Wed, 01 May 2024 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 01 May 2024 11:59:00 GMT", 0}, // already passed
+		{"Wednesday, 01-May-24 12:01:00 GMT", time.Minute},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelayCapsRetryAfter(t *testing.T) {
+	opts := Options{RetryBaseDelay: time.Second, RetryMaxDelay: 30 * time.Second}
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"short Retry-After", &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Second}, 5 * time.Second},
+		{"long Retry-After", &StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Hour}, 30 * time.Second},
+		{"wrapped", fmt.Errorf("page: %w", &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Minute}), 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(1, tt.err, opts); got != tt.want {
+			t.Errorf("%s: retryDelay() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Without Retry-After the jittered backoff stays under the cap too
+	for attempt := 1; attempt <= 10; attempt++ {
+		if got := retryDelay(attempt, &StatusError{StatusCode: http.StatusBadGateway}, opts); got > opts.RetryMaxDelay {
+			t.Errorf("attempt %d: retryDelay() = %v, above the %v cap", attempt, got, opts.RetryMaxDelay)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ManifestFile lists the pages of a fixture directory, mapping each HTML file
+// to the URL it was recorded from
+const ManifestFile = "manifest.json"
+
+// Fixtures is a directory of recorded pages, saved by `scraper record` and
+// served offline by ReplayTransport
+type Fixtures struct {
+	Dir string
+
+	mu    sync.Mutex
+	pages map[string]string // file name -> page URL
+}
+
+// LoadFixtures reads the manifest in dir. A missing manifest is an empty set
+// of fixtures.
+func LoadFixtures(dir string) (*Fixtures, error) {
+	f := &Fixtures{Dir: dir, pages: make(map[string]string)}
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &f.pages); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture manifest: %w", err)
+	}
+	return f, nil
+}
+
+// Pages returns the recorded page URLs by file name
+func (f *Fixtures) Pages() map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pages := make(map[string]string, len(f.pages))
+	for name, pageURL := range f.pages {
+		pages[name] = pageURL
+	}
+	return pages
+}
+
+// URLs returns the recorded page URLs in file name order
+func (f *Fixtures) URLs() []string {
+	pages := f.Pages()
+	names := make([]string, 0, len(pages))
+	for name := range pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	urls := make([]string, len(names))
+	for i, name := range names {
+		urls[i] = pages[name]
+	}
+	return urls
+}
+
+// Load returns the recorded body of pageURL, or nil if it wasn't recorded
+func (f *Fixtures) Load(pageURL string) ([]byte, error) {
+	f.mu.Lock()
+	name := ""
+	for file, u := range f.pages {
+		if u == pageURL {
+			name = file
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if name == "" {
+		return nil, nil
+	}
+	body, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	return body, nil
+}
+
+// Save writes body as the fixture of pageURL and updates the manifest
+func (f *Fixtures) Save(pageURL string, body []byte) (string, error) {
+	name, err := FixtureName(pageURL)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create fixture dir: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(f.Dir, name), body, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write fixture: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pages[name] = pageURL
+	data, err := json.MarshalIndent(f.pages, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(filepath.Join(f.Dir, ManifestFile), data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write fixture manifest: %w", err)
+	}
+	return name, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// FixtureName returns the file a page is recorded to, built from its host,
+// path and query, e.g. news.ycombinator.com_news_p_2.html
+func FixtureName(pageURL string) (string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse page URL: %w", err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("page URL %q has no host", pageURL)
+	}
+	name := u.Host + u.EscapedPath()
+	if u.RawQuery != "" {
+		name += "?" + u.RawQuery
+	}
+	name = strings.Trim(unsafeFileChars.ReplaceAllString(name, "_"), "_")
+	return name + ".html", nil
+}
+
+// ReplayTransport answers GET requests from recorded fixtures instead of the
+// network. Pages that weren't recorded, robots.txt included, are 404s.
+type ReplayTransport struct {
+	Fixtures *Fixtures
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Method == http.MethodGet {
+		var err error
+		body, err = t.Fixtures.Load(req.URL.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	status := http.StatusOK
+	header := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	if body == nil {
+		status = http.StatusNotFound
+		header = http.Header{"Content-Type": {"text/plain; charset=utf-8"}}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestFixtureName(t *testing.T) {
+	tests := map[string]string{
+		"https://news.ycombinator.com/":         "news.ycombinator.com.html",
+		"https://news.ycombinator.com/news?p=2": "news.ycombinator.com_news_p_2.html",
+		"https://lobste.rs/page/3":              "lobste.rs_page_3.html",
+		"http://localhost:8080/a%20b?x=1&y=two": "localhost_8080_a_20b_x_1_y_two.html",
+	}
+	for pageURL, want := range tests {
+		got, err := FixtureName(pageURL)
+		if err != nil {
+			t.Errorf("FixtureName(%q): %v", pageURL, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("FixtureName(%q) = %q, want %q", pageURL, got, want)
+		}
+	}
+}
+
+func TestReplayTransportServesSavedFixtures(t *testing.T) {
+	dir := t.TempDir()
+	recorded, err := LoadFixtures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorded.Save("https://news.ycombinator.com/news?p=2", []byte("<html>page 2</html>")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay from a fresh load so the manifest on disk is what gets used
+	fixtures, err := LoadFixtures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &ReplayTransport{Fixtures: fixtures}}
+
+	resp, err := client.Get("https://news.ycombinator.com/news?p=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "<html>page 2</html>" {
+		t.Errorf("got %d %q, want the recorded page", resp.StatusCode, body)
+	}
+
+	resp, err = client.Get("https://news.ycombinator.com/robots.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unrecorded page status = %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,29 @@
+package fetch
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestObserver records requests that reached the network
+type RequestObserver interface {
+	ObserveRequest(host string, code int, elapsed time.Duration)
+}
+
+// MetricsTransport reports every request to Metrics, with a code of 0 for
+// transport errors
+type MetricsTransport struct {
+	Base    http.RoundTripper
+	Metrics RequestObserver
+}
+
+func (t *MetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	code := 0
+	if err == nil {
+		code = resp.StatusCode
+	}
+	t.Metrics.ObserveRequest(req.URL.Host, code, time.Since(start))
+	return resp, err
+}
@@ -0,0 +1,303 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ProxyConfig configures outgoing proxies. It can be set in the site config
+// file under "proxies" or with the -proxy flags, which take precedence.
+type ProxyConfig struct {
+	// URLs are http://, https:// or socks5:// proxies, optionally with
+	// user:password@
+	URLs []string `json:"urls,omitempty" yaml:"urls,omitempty"`
+
+	// Rotation is "request" to use the next proxy for every request or
+	// "host" to keep each host on the same proxy while it stays healthy
+	Rotation string `json:"rotation,omitempty" yaml:"rotation,omitempty"`
+
+	// MaxFailures consecutive failures evict a proxy
+	MaxFailures int `json:"max_failures,omitempty" yaml:"max_failures,omitempty"`
+
+	// CheckURL is fetched through every proxy to check its health, at
+	// startup and every CheckInterval (e.g. "5m", the default; negative
+	// disables the periodic checks). Healthy proxies are restored.
+	CheckURL      string   `json:"check_url,omitempty" yaml:"check_url,omitempty"`
+	CheckInterval Duration `json:"check_interval,omitempty" yaml:"check_interval,omitempty"`
+}
+
+// Duration is a time.Duration written as a string like "90s" or "5m" in
+// config files
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Proxy rotation modes
+const (
+	rotatePerRequest = "request"
+	rotatePerHost    = "host"
+)
+
+const (
+	defaultProxyMaxFailures   = 3
+	defaultProxyCheckInterval = 5 * time.Minute
+)
+
+// Merge fills unset fields from the config file. Proxy URLs from both are used.
+func (c ProxyConfig) Merge(file ProxyConfig) ProxyConfig {
+	c.URLs = append(append([]string(nil), file.URLs...), c.URLs...)
+	if c.Rotation == "" {
+		c.Rotation = file.Rotation
+	}
+	if c.MaxFailures == 0 {
+		c.MaxFailures = file.MaxFailures
+	}
+	if c.CheckURL == "" {
+		c.CheckURL = file.CheckURL
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = file.CheckInterval
+	}
+	return c
+}
+
+// HealthCheckInterval returns how often to re-check proxies, 0 when the
+// periodic checks are disabled
+func (c ProxyConfig) HealthCheckInterval() time.Duration {
+	switch {
+	case c.CheckInterval == 0:
+		return defaultProxyCheckInterval
+	case c.CheckInterval < 0:
+		return 0
+	}
+	return time.Duration(c.CheckInterval)
+}
+
+var ErrNoHealthyProxy = errors.New("no healthy proxy available")
+
+type proxyState struct {
+	url      *url.URL
+	failures int // consecutive
+	evicted  bool
+}
+
+// ProxyPool hands out proxies in rotation and evicts those that keep failing
+type ProxyPool struct {
+	perHost     bool
+	maxFailures int
+	logger      *slog.Logger
+
+	mu      sync.Mutex
+	proxies []*proxyState
+	next    int
+	byHost  map[string]*proxyState
+}
+
+func NewProxyPool(cfg ProxyConfig, logger *slog.Logger) (*ProxyPool, error) {
+	p := &ProxyPool{
+		maxFailures: cfg.MaxFailures,
+		logger:      logger,
+		byHost:      make(map[string]*proxyState),
+	}
+	if p.maxFailures <= 0 {
+		p.maxFailures = defaultProxyMaxFailures
+	}
+
+	switch cfg.Rotation {
+	case "", rotatePerRequest:
+	case rotatePerHost:
+		p.perHost = true
+	default:
+		return nil, fmt.Errorf("unknown proxy rotation %q (use request or host)", cfg.Rotation)
+	}
+
+	for _, raw := range cfg.URLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", raw, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme in %q (use http, https or socks5)", u.Redacted())
+		}
+		p.proxies = append(p.proxies, &proxyState{url: u})
+	}
+	if len(p.proxies) == 0 {
+		return nil, errors.New("no proxies configured")
+	}
+	return p, nil
+}
+
+// pick returns the proxy to use for a request to host
+func (p *ProxyPool) pick(host string) (*proxyState, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.perHost {
+		if s, ok := p.byHost[host]; ok && !s.evicted {
+			return s, nil
+		}
+	}
+
+	for range p.proxies {
+		s := p.proxies[p.next]
+		p.next = (p.next + 1) % len(p.proxies)
+		if s.evicted {
+			continue
+		}
+		if p.perHost {
+			p.byHost[host] = s
+		}
+		return s, nil
+	}
+	return nil, ErrNoHealthyProxy
+}
+
+// report records the outcome of a request through s
+func (p *ProxyPool) report(s *proxyState, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ok {
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if s.failures >= p.maxFailures && !s.evicted {
+		s.evicted = true
+		p.logger.Warn("Evicting proxy after consecutive failures", "proxy", s.url.Redacted(), "failures", s.failures)
+	}
+}
+
+// Healthy returns the number of proxies that are not evicted
+func (p *ProxyPool) Healthy() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, s := range p.proxies {
+		if !s.evicted {
+			n++
+		}
+	}
+	return n
+}
+
+// CheckHealth fetches checkURL through every proxy, evicted ones included.
+// Proxies that answer are restored, the others are evicted.
+func (p *ProxyPool) CheckHealth(ctx context.Context, checkURL string, timeout time.Duration) {
+	p.mu.Lock()
+	proxies := append([]*proxyState(nil), p.proxies...)
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range proxies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := probeProxy(ctx, s.url, checkURL, timeout)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if err != nil {
+				if !s.evicted {
+					p.logger.Warn("Evicting proxy that failed its health check", "proxy", s.url.Redacted(), "error", err)
+				}
+				s.evicted = true
+				return
+			}
+			if s.evicted {
+				p.logger.Info("Restoring proxy that passed its health check", "proxy", s.url.Redacted())
+			}
+			s.evicted = false
+			s.failures = 0
+		}()
+	}
+	wg.Wait()
+}
+
+// RunHealthChecks checks every proxy every interval until ctx is canceled
+func (p *ProxyPool) RunHealthChecks(ctx context.Context, checkURL string, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.CheckHealth(ctx, checkURL, timeout)
+		}
+	}
+}
+
+func probeProxy(ctx context.Context, proxyURL *url.URL, checkURL string, timeout time.Duration) error {
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+type proxyContextKey struct{}
+
+// ProxyFromContext is an http.Transport Proxy func that uses the proxy
+// chosen by ProxyTransport for the request, if any
+func ProxyFromContext(req *http.Request) (*url.URL, error) {
+	u, _ := req.Context().Value(proxyContextKey{}).(*url.URL)
+	return u, nil
+}
+
+// ProxyTransport picks a proxy for each request and reports the outcome to
+// the pool. Base must be an *http.Transport whose Proxy is ProxyFromContext.
+type ProxyTransport struct {
+	Base http.RoundTripper
+	Pool *ProxyPool
+}
+
+func (t *ProxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s, err := t.Pool.pick(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(req.Context(), proxyContextKey{}, s.url)
+	resp, err := t.Base.RoundTrip(req.WithContext(ctx))
+
+	// Requests canceled by us say nothing about the proxy
+	if req.Context().Err() == nil {
+		t.Pool.report(s, err == nil && resp.StatusCode != http.StatusProxyAuthRequired)
+	}
+	return resp, err
+}
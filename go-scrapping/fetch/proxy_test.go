@@ -0,0 +1,327 @@
+package fetch
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// standInProxy is an HTTP forward proxy that answers every request itself
+// and counts the hosts it was asked for
+type standInProxy struct {
+	*httptest.Server
+	mu    sync.Mutex
+	hosts []string
+}
+
+func newStandInProxy(t *testing.T) *standInProxy {
+	t.Helper()
+	p := &standInProxy{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.hosts = append(p.hosts, r.URL.Host)
+		p.mu.Unlock()
+		io.WriteString(w, "<html><title>proxied</title></html>")
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *standInProxy) Hits() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.hosts...)
+}
+
+// deadProxyURL returns the address of a port nothing listens on
+func deadProxyURL(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return "http://" + addr
+}
+
+// newSOCKS5StandIn runs a minimal no-auth SOCKS5 server that supports CONNECT
+func newSOCKS5StandIn(t *testing.T) (string, *atomic.Int64) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	conns := new(atomic.Int64)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go serveSOCKS5(conn)
+		}
+	}()
+	return "socks5://" + l.Addr().String(), conns
+}
+
+func serveSOCKS5(conn net.Conn) {
+	defer conn.Close()
+
+	// Greeting: VER NMETHODS METHODS...; answer "no authentication"
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, head[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		n := make([]byte, 1)
+		io.ReadFull(conn, n)
+		name := make([]byte, n[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func newProxyClient(t *testing.T, cfg ProxyConfig) (*http.Client, *ProxyPool) {
+	t.Helper()
+	pool, err := NewProxyPool(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := &http.Transport{Proxy: ProxyFromContext}
+	t.Cleanup(base.CloseIdleConnections)
+	return &http.Client{Timeout: 5 * time.Second, Transport: &ProxyTransport{Base: base, Pool: pool}}, pool
+}
+
+func get(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+func TestProxyRotationPerRequest(t *testing.T) {
+	a, b := newStandInProxy(t), newStandInProxy(t)
+	client, _ := newProxyClient(t, ProxyConfig{URLs: []string{a.URL, b.URL}})
+
+	for i := 0; i < 4; i++ {
+		if err := get(client, "http://site.test/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(a.Hits()) != 2 || len(b.Hits()) != 2 {
+		t.Errorf("proxy hits = %d and %d, want 2 each", len(a.Hits()), len(b.Hits()))
+	}
+}
+
+func TestProxyRotationPerHost(t *testing.T) {
+	a, b := newStandInProxy(t), newStandInProxy(t)
+	client, _ := newProxyClient(t, ProxyConfig{URLs: []string{a.URL, b.URL}, Rotation: rotatePerHost})
+
+	for i := 0; i < 3; i++ {
+		for _, url := range []string{"http://one.test/", "http://two.test/"} {
+			if err := get(client, url); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Each host sticks to the proxy it was first given
+	for _, p := range []*standInProxy{a, b} {
+		hits := p.Hits()
+		if len(hits) != 3 {
+			t.Fatalf("proxy got %d requests, want 3: %v", len(hits), hits)
+		}
+		for _, host := range hits {
+			if host != hits[0] {
+				t.Errorf("proxy served both hosts: %v", hits)
+			}
+		}
+	}
+}
+
+func TestProxyEvictedAfterConsecutiveFailures(t *testing.T) {
+	good := newStandInProxy(t)
+	client, pool := newProxyClient(t, ProxyConfig{
+		URLs:        []string{deadProxyURL(t), good.URL},
+		MaxFailures: 2,
+	})
+
+	failures := 0
+	for i := 0; i < 8; i++ {
+		if err := get(client, "http://site.test/"); err != nil {
+			failures++
+		}
+	}
+
+	if failures != 2 {
+		t.Errorf("%d requests failed, want 2 before the dead proxy is evicted", failures)
+	}
+	if n := pool.Healthy(); n != 1 {
+		t.Errorf("%d healthy proxies, want 1", n)
+	}
+	if n := len(good.Hits()); n != 6 {
+		t.Errorf("good proxy got %d requests, want 6", n)
+	}
+}
+
+func TestProxyPoolExhausted(t *testing.T) {
+	client, _ := newProxyClient(t, ProxyConfig{URLs: []string{deadProxyURL(t)}, MaxFailures: 1})
+
+	get(client, "http://site.test/")
+	if err := get(client, "http://site.test/"); !errors.Is(err, ErrNoHealthyProxy) {
+		t.Errorf("err = %v, want %v", err, ErrNoHealthyProxy)
+	}
+}
+
+func TestProxyHealthCheckRestoresAndEvicts(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+	socks, _ := newSOCKS5StandIn(t)
+	dead := deadProxyURL(t)
+
+	_, pool := newProxyClient(t, ProxyConfig{URLs: []string{socks, dead}, MaxFailures: 1})
+	for _, s := range pool.proxies {
+		pool.report(s, false)
+	}
+	if pool.Healthy() != 0 {
+		t.Fatal("expected every proxy to be evicted")
+	}
+
+	pool.CheckHealth(context.Background(), origin.URL, time.Second)
+
+	if pool.proxies[0].evicted || !pool.proxies[1].evicted {
+		t.Errorf("after health check: socks evicted = %v, dead evicted = %v, want false and true",
+			pool.proxies[0].evicted, pool.proxies[1].evicted)
+	}
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "origin")
+	}))
+	defer origin.Close()
+	socks, conns := newSOCKS5StandIn(t)
+	client, _ := newProxyClient(t, ProxyConfig{URLs: []string{socks}})
+
+	resp, err := client.Get(origin.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "origin" {
+		t.Errorf("body = %q, want the origin's response", body)
+	}
+	if conns.Load() == 0 {
+		t.Error("request did not go through the SOCKS5 proxy")
+	}
+}
+
+func TestUserAgentPool(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.UserAgent()]++
+		mu.Unlock()
+	}))
+	defer origin.Close()
+
+	opts := Options{UserAgent: "Default/1.0", UserAgents: []string{"Agent/A", "Agent/B"}}
+	for i := 0; i < 30; i++ {
+		resp, err := fetchOnce(context.Background(), origin.URL, origin.Client(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if len(seen) != 2 || seen["Agent/A"] == 0 || seen["Agent/B"] == 0 {
+		t.Errorf("user agents seen = %v, want both pool entries and nothing else", seen)
+	}
+}
+
+func TestProxyConfigCheckInterval(t *testing.T) {
+	var fromYAML ProxyConfig
+	if err := yaml.Unmarshal([]byte("check_url: https://example.com/\ncheck_interval: 90s\n"), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	if got := fromYAML.HealthCheckInterval(); got != 90*time.Second {
+		t.Errorf("YAML check_interval = %v, want 90s", got)
+	}
+
+	var fromJSON ProxyConfig
+	if err := json.Unmarshal([]byte(`{"check_interval": "-1s"}`), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if got := fromJSON.HealthCheckInterval(); got != 0 {
+		t.Errorf("negative check_interval = %v, want checks disabled", got)
+	}
+	if err := json.Unmarshal([]byte(`{"check_interval": "soon"}`), &fromJSON); err == nil {
+		t.Error("accepted an invalid check_interval")
+	}
+
+	// Flags win over the file, which wins over the default
+	if got := (ProxyConfig{}).Merge(fromYAML).HealthCheckInterval(); got != 90*time.Second {
+		t.Errorf("merged interval = %v, want the file's 90s", got)
+	}
+	flags := ProxyConfig{CheckInterval: Duration(time.Minute)}
+	if got := flags.Merge(fromYAML).HealthCheckInterval(); got != time.Minute {
+		t.Errorf("merged interval = %v, want the flag's 1m", got)
+	}
+	if got := (ProxyConfig{}).HealthCheckInterval(); got != defaultProxyCheckInterval {
+		t.Errorf("default interval = %v, want %v", got, defaultProxyCheckInterval)
+	}
+}
@@ -0,0 +1,174 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Politeness controls how hard the scraper may hit a single host
+type Politeness struct {
+	Rate           float64       // sustained requests per second per host, 0 = unlimited
+	Burst          int           // token bucket size per host
+	MinDelay       time.Duration // minimum gap between request starts on one host
+	MaxConcurrency int           // maximum in-flight requests per host, 0 = unlimited
+}
+
+// HostLimiter hands out per-host permission to send a request. Each host gets
+// its own token bucket, minimum delay and concurrency slots, created lazily
+// on first use.
+type HostLimiter struct {
+	config Politeness
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	limiter *rate.Limiter
+	slots   chan struct{}
+
+	mu       sync.Mutex
+	minDelay time.Duration
+	next     time.Time
+}
+
+func NewHostLimiter(config Politeness) *HostLimiter {
+	return &HostLimiter{config: config, hosts: make(map[string]*hostState)}
+}
+
+func (l *HostLimiter) state(host string) *hostState {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s, ok := l.hosts[host]; ok {
+		return s
+	}
+
+	s := &hostState{minDelay: l.config.MinDelay}
+	if l.config.Rate > 0 {
+		burst := l.config.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		s.limiter = rate.NewLimiter(rate.Limit(l.config.Rate), burst)
+	}
+	if l.config.MaxConcurrency > 0 {
+		s.slots = make(chan struct{}, l.config.MaxConcurrency)
+	}
+	l.hosts[host] = s
+	return s
+}
+
+// SetMinDelay raises the minimum delay for one host, e.g. from a robots.txt
+// Crawl-delay. It never lowers the configured default.
+func (l *HostLimiter) SetMinDelay(host string, d time.Duration) {
+	s := l.state(host)
+	s.mu.Lock()
+	if d > s.minDelay {
+		s.minDelay = d
+	}
+	s.mu.Unlock()
+}
+
+// Acquire blocks until a request to host may start, or ctx is done. The
+// returned release func frees the host's concurrency slot and must be called
+// once the request has finished.
+func (l *HostLimiter) Acquire(ctx context.Context, host string) (func(), error) {
+	s := l.state(host)
+
+	release := func() {}
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			release = func() { <-s.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if s.limiter != nil {
+		if err := s.limiter.Wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	if err := s.waitMinDelay(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// waitMinDelay reserves the host's next start slot and sleeps until it
+func (s *hostState) waitMinDelay(ctx context.Context) error {
+	s.mu.Lock()
+	if s.minDelay <= 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	start := s.next
+	if start.Before(now) {
+		start = now
+	}
+	s.next = start.Add(s.minDelay)
+	s.mu.Unlock()
+
+	wait := time.Until(start)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RateLimitedTransport applies a HostLimiter to every request sent through
+// the shared http.Client. The host's concurrency slot is held until the
+// response body is closed.
+type RateLimitedTransport struct {
+	Base    http.RoundTripper
+	Limiter *HostLimiter
+}
+
+func (t *RateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.Limiter.Acquire(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseOnClose calls release exactly once when the body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,84 @@
+package fetch
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// acquireN takes n permits for host, releasing each right away, and returns
+// how long that took
+func acquireN(t *testing.T, l *HostLimiter, host string, n int) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		release, err := l.Acquire(context.Background(), host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	return time.Since(start)
+}
+
+func TestHostLimiterBurstThenRate(t *testing.T) {
+	l := NewHostLimiter(Politeness{Rate: 20, Burst: 3})
+
+	// The burst goes out at once, then requests are spaced 50ms apart
+	if d := acquireN(t, l, "a.example", 3); d > 40*time.Millisecond {
+		t.Errorf("burst of 3 took %v, want no waiting", d)
+	}
+	if d := acquireN(t, l, "a.example", 2); d < 80*time.Millisecond {
+		t.Errorf("2 requests past the burst took %v, want about 100ms", d)
+	}
+
+	// Each host has its own bucket, matched case-insensitively
+	if d := acquireN(t, l, "b.example", 3); d > 40*time.Millisecond {
+		t.Errorf("another host waited %v for its burst", d)
+	}
+	if d := acquireN(t, l, "A.EXAMPLE", 1); d < 20*time.Millisecond {
+		t.Errorf("upper-case host took %v, want it to share a.example's bucket", d)
+	}
+}
+
+func TestHostLimiterMinDelay(t *testing.T) {
+	l := NewHostLimiter(Politeness{MinDelay: 40 * time.Millisecond})
+
+	// Starts are at least MinDelay apart: 0, 40ms, 80ms
+	if d := acquireN(t, l, "a.example", 3); d < 70*time.Millisecond {
+		t.Errorf("3 requests took %v, want at least 80ms", d)
+	}
+
+	// A Crawl-delay can raise the delay for one host but never lower it
+	l.SetMinDelay("slow.example", 100*time.Millisecond)
+	l.SetMinDelay("fast.example", time.Millisecond)
+	if d := acquireN(t, l, "slow.example", 2); d < 90*time.Millisecond {
+		t.Errorf("raised delay: 2 requests took %v, want at least 100ms", d)
+	}
+	if d := acquireN(t, l, "fast.example", 2); d < 30*time.Millisecond {
+		t.Errorf("lowered delay: 2 requests took %v, want the default 40ms", d)
+	}
+}
+
+func TestHostLimiterMaxConcurrency(t *testing.T) {
+	l := NewHostLimiter(Politeness{MaxConcurrency: 1})
+
+	release, err := l.Acquire(context.Background(), "a.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The host's only slot is taken until release is called
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, "a.example"); err == nil {
+		t.Error("acquired a second slot while the first was held")
+	}
+
+	release()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := l.Acquire(ctx, "a.example"); err != nil {
+		t.Errorf("slot not freed by release: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Options controls how pages are requested
+type Options struct {
+	// UserAgent is sent with every request, unless UserAgents is set to a
+	// pool to pick a random one from for each request
+	UserAgent  string
+	UserAgents []string
+
+	// Retry behaviour for transient transport errors, 429 and 500/502/503/504
+	// responses
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+// pickUserAgent returns a random agent from the pool, or UserAgent when the
+// pool is empty
+func (o Options) pickUserAgent() string {
+	if len(o.UserAgents) == 0 {
+		return o.UserAgent
+	}
+	return o.UserAgents[rand.Intn(len(o.UserAgents))]
+}
+
+// StatusError is returned when a server answers with a non-200 status
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("received non-200 status code: %d", e.StatusCode)
+}
+
+// retryable reports whether the request may succeed if tried again. Other
+// 5xx codes, like 501 Not Implemented, won't change on their own.
+func (e *StatusError) retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Get sends a GET for url, retrying transient transport errors and
+// retryable statuses with jittered exponential backoff. A Retry-After header on a 429
+// or 503 takes precedence over the computed delay. The returned response
+// always has a 200 status; the caller must close its body.
+func Get(ctx context.Context, url string, client *http.Client, opts Options) (*http.Response, int, error) {
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		resp, err := fetchOnce(ctx, url, client, opts)
+		if err == nil {
+			return resp, attempt, nil
+		}
+		lastErr = err
+
+		if attempt > opts.MaxRetries || !shouldRetry(ctx, err) {
+			return nil, attempt, lastErr
+		}
+
+		timer := time.NewTimer(retryDelay(attempt, err, opts))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, fmt.Errorf("%w (last error: %v)", ctx.Err(), lastErr)
+		case <-timer.C:
+		}
+	}
+}
+
+// fetchOnce sends a single GET request and turns non-200 responses into a
+// *StatusError
+func fetchOnce(ctx context.Context, url string, client *http.Client, opts Options) (*http.Response, error) {
+	// Create a request with context
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers to mimic a browser
+	req.Header.Set("User-Agent", opts.pickUserAgent())
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+
+	// Send the request
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		se := &StatusError{StatusCode: resp.StatusCode}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			se.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, se
+	}
+	return resp, nil
+}
+
+func shouldRetry(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.retryable()
+	}
+	// Hosts that don't exist and certificates that don't verify stay that
+	// way. Other transport errors (timeouts, resets) are usually transient.
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var certErr *tls.CertificateVerificationError
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &hostErr) || errors.As(err, &authErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+	return true
+}
+
+// retryDelay returns how long to wait before retrying after err: the
+// server's Retry-After when it sent one, else the backoff for attempt.
+// Either way the wait is capped at RetryMaxDelay.
+func retryDelay(attempt int, err error, opts Options) time.Duration {
+	var se *StatusError
+	if errors.As(err, &se) && se.RetryAfter > 0 {
+		return min(se.RetryAfter, opts.RetryMaxDelay)
+	}
+	return backoffDelay(attempt, opts.RetryBaseDelay, opts.RetryMaxDelay)
+}
+
+// backoffDelay returns a random delay in [0, min(maxDelay, base*2^(attempt-1))]
+// ("full jitter") so that workers retrying together don't stay in lockstep
+func backoffDelay(attempt int, base, maxDelay time.Duration) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	ceiling := base << (attempt - 1)
+	if ceiling <= 0 || ceiling > maxDelay {
+		ceiling = maxDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// parseRetryAfter understands both forms of the Retry-After header: a number
+// of seconds or an HTTP date. It returns 0 when the header is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
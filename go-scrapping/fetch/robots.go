@@ -0,0 +1,265 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsRules is the group of a robots.txt file that applies to our user agent
+type robotsRules struct {
+	rules       []robotsRule
+	crawlDelay  time.Duration
+	disallowAll bool
+}
+
+type robotsRule struct {
+	allow  bool
+	length int
+	re     *regexp.Regexp
+}
+
+// newRobotsRule compiles a robots.txt path pattern, supporting "*" wildcards
+// and a trailing "$" end anchor
+func newRobotsRule(allow bool, pattern string) robotsRule {
+	anchored := strings.HasSuffix(pattern, "$")
+	expr := strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(expr, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr = "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return robotsRule{allow: allow, length: len(pattern), re: regexp.MustCompile(expr)}
+}
+
+// Allowed reports whether path (including any query) may be fetched. The
+// longest matching rule wins and Allow wins ties, as in RFC 9309.
+func (r *robotsRules) Allowed(path string) bool {
+	if r.disallowAll {
+		return false
+	}
+
+	allowed, bestLen := true, -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if rule.length > bestLen || (rule.length == bestLen && rule.allow) {
+			allowed, bestLen = rule.allow, rule.length
+		}
+	}
+	return allowed
+}
+
+// parseRobots extracts the rules for userAgent from a robots.txt body. A group
+// naming the agent takes precedence over the "*" group.
+func parseRobots(body io.Reader, userAgent string) *robotsRules {
+	agent := strings.ToLower(userAgent)
+
+	var (
+		specific, wildcard *robotsRules
+		current            []*robotsRules
+		inRules            bool
+	)
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				current, inRules = nil, false
+			}
+			name := strings.ToLower(value)
+			switch {
+			case name == "*":
+				if wildcard == nil {
+					wildcard = &robotsRules{}
+				}
+				current = append(current, wildcard)
+			case name != "" && strings.Contains(agent, name):
+				if specific == nil {
+					specific = &robotsRules{}
+				}
+				current = append(current, specific)
+			default:
+				// Keep parsing the group, but don't record it
+				current = append(current, &robotsRules{})
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// "Disallow:" with no path allows everything
+				continue
+			}
+			for _, g := range current {
+				g.rules = append(g.rules, newRobotsRule(key == "allow", value))
+			}
+		case "crawl-delay":
+			inRules = true
+			secs, err := strconv.ParseFloat(value, 64)
+			if err != nil || secs < 0 {
+				continue
+			}
+			for _, g := range current {
+				g.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+
+	if specific != nil {
+		return specific
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return &robotsRules{}
+}
+
+// robotsTTL is how long fetched rules are reused. RFC 9309 asks crawlers
+// not to cache robots.txt for more than a day.
+const robotsTTL = 24 * time.Hour
+
+// robotsFailureTTL is how long a failed robots.txt fetch is remembered, so a
+// down server isn't asked again for every URL
+const robotsFailureTTL = time.Minute
+
+// RobotsCache fetches robots.txt per origin and answers whether URLs may be
+// scraped. Rules are refreshed after robotsTTL. A robots.txt that couldn't be
+// fetched is an error for every URL of its origin until it is tried again
+// after robotsFailureTTL. Crawl-delay values are forwarded to the host limiter.
+type RobotsCache struct {
+	client    *http.Client
+	userAgent string
+	limiter   *HostLimiter
+
+	mu      sync.Mutex
+	origins map[string]*robotsEntry
+}
+
+// robotsEntry holds an origin's rules, or the error of its last fetch. Its
+// mutex makes concurrent checks of the same origin wait for one fetch.
+type robotsEntry struct {
+	mu        sync.Mutex
+	rules     *robotsRules
+	err       error
+	fetchedAt time.Time
+}
+
+func NewRobotsCache(client *http.Client, userAgent string, limiter *HostLimiter) *RobotsCache {
+	return &RobotsCache{
+		client:    client,
+		userAgent: userAgent,
+		limiter:   limiter,
+		origins:   make(map[string]*robotsEntry),
+	}
+}
+
+// Allowed reports whether rawURL may be fetched. It returns an error when the
+// origin's robots.txt can't be fetched, so the URL can be retried later.
+func (c *RobotsCache) Allowed(ctx context.Context, rawURL string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	rules, err := c.rules(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return rules.Allowed(path), nil
+}
+
+// rules returns the cached rules for the URL's origin, fetching them when
+// missing or expired
+func (c *RobotsCache) rules(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	origin := u.Scheme + "://" + u.Host
+	c.mu.Lock()
+	entry, ok := c.origins[origin]
+	if !ok {
+		entry = &robotsEntry{}
+		c.origins[origin] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	switch {
+	case entry.rules != nil && time.Since(entry.fetchedAt) < robotsTTL:
+		return entry.rules, nil
+	case entry.err != nil && time.Since(entry.fetchedAt) < robotsFailureTTL:
+		return nil, entry.err
+	}
+
+	rules, err := c.fetch(ctx, origin)
+	if err != nil {
+		// A canceled check says nothing about the server, so don't remember it
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		entry.rules, entry.err, entry.fetchedAt = nil, fmt.Errorf("failed to fetch robots.txt: %w", err), time.Now()
+		return nil, entry.err
+	}
+	entry.rules, entry.err, entry.fetchedAt = rules, nil, time.Now()
+	if rules.crawlDelay > 0 {
+		c.limiter.SetMinDelay(u.Hostname(), rules.crawlDelay)
+	}
+	return rules, nil
+}
+
+// fetch downloads and parses robots.txt for an origin. Following RFC 9309, a
+// missing file (4xx) allows everything while an unreachable one (5xx or
+// network error) returns an error, meaning nothing may be fetched yet.
+func (c *RobotsCache) fetch(ctx context.Context, origin string) (*robotsRules, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	case resp.StatusCode != http.StatusOK:
+		return &robotsRules{}, nil
+	}
+
+	// RFC 9309 requires parsing at least 500 KiB; ignore anything beyond that
+	return parseRobots(io.LimitReader(resp.Body, 500<<10), c.userAgent), nil
+}
@@ -0,0 +1,129 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRobotsRulesAllowed(t *testing.T) {
+	const robots = `
+User-agent: *
+Disallow: /
+
+User-agent: other-bot
+Disallow:
+
+User-agent: test-agent
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+Allow: /tie
+Disallow: /tie
+Disallow: # empty rules allow everything
+`
+	rules := parseRobots(strings.NewReader(robots), "Test-Agent/1.0")
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/news", true},
+		{"/private", false},
+		{"/private/page", false},
+		{"/private/public/page", true}, // the longer Allow wins
+		{"/files/report.pdf", false},
+		{"/files/report.pdf?download=1", true}, // "$" anchors the end
+		{"/search?q=go", false},
+		{"/search", true},
+		{"/tie", true}, // Allow wins rules of the same length
+	}
+	for _, tt := range tests {
+		if got := rules.Allowed(tt.path); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	// Agents without a group of their own fall back to "*"
+	if parseRobots(strings.NewReader(robots), "someone-else").Allowed("/news") {
+		t.Error("the * group's Disallow: / not applied to an unnamed agent")
+	}
+}
+
+func TestRobotsCacheForwardsCrawlDelay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "User-agent: *\nCrawl-delay: 0.1\n")
+	}))
+	defer srv.Close()
+
+	limiter := NewHostLimiter(Politeness{})
+	cache := NewRobotsCache(srv.Client(), "test-agent", limiter)
+	if ok, err := cache.Allowed(context.Background(), srv.URL+"/"); err != nil || !ok {
+		t.Fatalf("Allowed = %v, %v; want true", ok, err)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	if d := acquireN(t, limiter, u.Hostname(), 2); d < 90*time.Millisecond {
+		t.Errorf("2 requests took %v, want the 100ms crawl delay between them", d)
+	}
+}
+
+func TestRobotsCacheRetriesFailuresAndExpires(t *testing.T) {
+	var fetches atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "User-agent: *\nDisallow: /private\n")
+	}))
+	defer srv.Close()
+
+	cache := NewRobotsCache(srv.Client(), "test-agent", NewHostLimiter(Politeness{}))
+	allowed := func(path string) bool {
+		t.Helper()
+		ok, err := cache.Allowed(context.Background(), srv.URL+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// An unreachable robots.txt is an error, remembered for a short while
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Allowed(context.Background(), srv.URL+"/public"); err == nil {
+			t.Error("no error while robots.txt was unreachable")
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("robots.txt fetched %d times while down, want 1", n)
+	}
+
+	// Once the failure expires the rules are fetched again
+	down.Store(false)
+	cache.origins[srv.URL].fetchedAt = time.Now().Add(-robotsFailureTTL)
+	if !allowed("/public") || allowed("/private") {
+		t.Error("rules not applied once robots.txt was reachable again")
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("robots.txt fetched %d times, want 2", n)
+	}
+
+	// Rules are fetched again once they expire
+	cache.origins[srv.URL].fetchedAt = time.Now().Add(-robotsTTL)
+	allowed("/public")
+	if n := fetches.Load(); n != 3 {
+		t.Errorf("robots.txt fetched %d times after expiry, want 3", n)
+	}
+}
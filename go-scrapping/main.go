@@ -2,341 +2,487 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"strings"
 	"time"
 
-	"github.com/PuerkitoBio/goquery"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+	"github.com/NoxturneDev/hn-scrapper/pipeline"
+	"github.com/NoxturneDev/hn-scrapper/store"
 )
 
-// ScrapedItem represents a title and URL scraped from a website
-type ScrapedItem struct {
-	Title string
-	URL   string
-}
-
 // Config holds application configuration
 type Config struct {
 	DBPath      string
+	ConfigPath  string
 	Concurrency int
 	Timeout     time.Duration
 	UserAgent   string
+
+	// UserAgents is a pool to pick a random User-Agent from for each
+	// request. UserAgent is still used for robots.txt.
+	UserAgents []string
+
+	// Proxy lists the proxies to rotate through, none by default
+	Proxy fetch.ProxyConfig
+
+	// Retry behaviour for transient transport errors, 429 and 500/502/503/504
+	// responses
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	RetryFailed    bool
+
+	// Per-host politeness limits applied to every request
+	Politeness fetch.Politeness
+
+	// Crawl mode follows same-host links up to MaxDepth hops from the seeds.
+	// MaxPages caps the URLs scraped in any mode (0 = unlimited).
+	Crawl    bool
+	MaxDepth int
+	MaxPages int
+
+	// Outputs lists the -output sink specs, defaulting to SQLite. Items are
+	// written in batches of BatchSize, or whatever arrived within
+	// FlushInterval, each batch in one transaction.
+	Outputs       stringList
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// CacheDir enables the conditional-request HTTP cache. Entries younger
+	// than CacheMaxAge are reused without asking the server.
+	CacheDir    string
+	CacheMaxAge time.Duration
+	PurgeCache  bool
+
+	// Daemon keeps running and scrapes each site on its cron schedule.
+	// DefaultSchedule applies to sites without one in the config.
+	Daemon          bool
+	DefaultSchedule string
+
+	// ShutdownTimeout bounds how long in-flight pages may keep running after
+	// an interrupt
+	ShutdownTimeout time.Duration
+
+	// Articles follows each item's outbound link and stores its readable
+	// content, using up to ArticleConcurrency extra workers
+	Articles           bool
+	ArticleConcurrency int
+
+	// Resume continues the queue persisted by an interrupted run
+	Resume bool
+
+	// IgnoreRobots disables robots.txt checks, for sites we own
+	IgnoreRobots bool
+
+	// MetricsAddr serves Prometheus metrics on /metrics when set
+	MetricsAddr string
+
+	// LogFormat is "json" or "text"; LogLevel is debug, info, warn or error
+	LogFormat string
+	LogLevel  string
+
+	// Sites is loaded from ConfigPath (or the built-in Hacker News profile)
+	// after flag parsing
+	Sites SitesConfig
+
+	// RenderURL is the rendering service used by sites with fetcher: render
+	RenderURL string
+
+	// ReplayDir serves pages saved by `scraper record` instead of fetching
+	// them, scraping the recorded URLs when no config is given
+	ReplayDir string
+
+	// run is the pipeline configuration derived from the flags and Sites,
+	// with the extractors, fetchers and robots cache built in main
+	run pipeline.Config
 }
 
 func main() {
+	// Subcommands have their own flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "search":
+			if err := runSearch(os.Args[2:]); err != nil {
+				log.Fatalf("search: %v", err)
+			}
+			return
+		case "serve":
+			if err := runServe(os.Args[2:]); err != nil {
+				log.Fatalf("serve: %v", err)
+			}
+			return
+		case "report":
+			if err := runReport(os.Args[2:]); err != nil {
+				log.Fatalf("report: %v", err)
+			}
+			return
+		case "runs":
+			if err := runRuns(os.Args[2:]); err != nil {
+				log.Fatalf("runs: %v", err)
+			}
+			return
+		case "migrate":
+			if err := runMigrate(os.Args[2:]); err != nil {
+				log.Fatalf("migrate: %v", err)
+			}
+			return
+		case "record":
+			if err := runRecord(os.Args[2:]); err != nil {
+				log.Fatalf("record: %v", err)
+			}
+			return
+		}
+	}
+
 	// Parse command line flags
 	config := parseFlags()
 
-	// Set up logging
-	logger := log.New(os.Stdout, "[scraper] ", log.LstdFlags)
+	// Set up structured logging. Logs go to stderr so they never mix with
+	// items written by the stdout sink.
+	logger, err := newLogger(os.Stderr, config.LogFormat, config.LogLevel, "scraper")
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	// Load site profiles and build the per-host extractors
+	config.Sites = defaultSitesConfig()
+	if config.ConfigPath != "" {
+		sites, err := loadSitesConfig(config.ConfigPath)
+		if err != nil {
+			fatal(logger, "Failed to load site config", "error", err)
+		}
+		config.Sites = sites
+	}
+	config.Proxy = config.Proxy.Merge(config.Sites.Proxies)
+	config.UserAgents = append(config.UserAgents, config.Sites.UserAgents...)
+	config.run = config.pipelineConfig()
+	config.run.Extractors = newExtractorRegistry(config.Sites)
+	config.run.Alerts, err = pipeline.NewAlerter(config.Sites.Alerts)
+	if err != nil {
+		fatal(logger, "Failed to set up alerts", "error", err)
+	}
+
+	// Purge the HTTP cache and exit when asked to
+	if config.PurgeCache {
+		if config.CacheDir == "" {
+			fatal(logger, "-purge-cache requires -cache-dir")
+		}
+		cache, err := fetch.NewCache(config.CacheDir, 0)
+		if err != nil {
+			fatal(logger, "Failed to open cache", "error", err)
+		}
+		n, err := cache.Purge()
+		if err != nil {
+			fatal(logger, "Failed to purge cache", "error", err)
+		}
+		logger.Info("Purged cached responses", "count", n, "dir", config.CacheDir)
+		return
+	}
 
 	// Create context that can be canceled on SIGINT
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Handle SIGINT (Ctrl+C)
-	c := make(chan os.Signal, 1)
+	// Handle SIGINT (Ctrl+C). A second interrupt skips the graceful drain.
+	c := make(chan os.Signal, 2)
 	signal.Notify(c, os.Interrupt)
 	go func() {
 		<-c
-		logger.Println("Received interrupt signal, shutting down gracefully...")
+		logger.Info("Received interrupt signal, shutting down gracefully")
 		cancel()
+		<-c
+		fatal(logger, "Received second interrupt signal, exiting immediately")
 	}()
 
 	// Initialize SQLite DB
-	db, err := initDB(config.DBPath)
+	db, err := store.Open(config.DBPath)
 	if err != nil {
-		logger.Fatalf("Failed to initialize database: %v", err)
+		fatal(logger, "Failed to initialize database", "error", err)
 	}
 	defer db.Close()
 
-	// Create table to store titles
-	if err := createTable(db); err != nil {
-		logger.Fatalf("Failed to create table: %v", err)
+	// Bring the schema up to date, see `scraper migrate`
+	if err := store.Migrate(db); err != nil {
+		fatal(logger, "Failed to migrate database", "error", err)
 	}
 
-	// URLs to scrape - in a real app, these could come from a config file or command line args
-	urls := getURLsToScrape()
-
-	// Create a custom HTTP client with timeout
-	client := &http.Client{
-		Timeout: config.Timeout,
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-			IdleConnTimeout:     90 * time.Second,
-		},
+	// Export metrics for long-running scrapes
+	if config.MetricsAddr != "" {
+		config.run.Metrics = pipeline.NewMetrics(config.Sites.hosts())
+		srv := serveMetrics(config.MetricsAddr, config.run.Metrics, logger)
+		defer srv.Close()
 	}
 
-	// Process URLs with worker pool pattern
-	if err := processURLs(ctx, urls, db, client, config, logger); err != nil {
-		logger.Fatalf("Error processing URLs: %v", err)
+	// Create a custom HTTP client with timeout, rate limited per host
+	limiter := fetch.NewHostLimiter(config.Politeness)
+	base := &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
 	}
-
-	logger.Println("Scraping completed successfully!")
-}
-
-func parseFlags() Config {
-	dbPath := flag.String("db", "./scraped_titles.db", "Path to SQLite database file")
-	concurrency := flag.Int("concurrency", 10, "Number of concurrent scrapers")
-	timeout := flag.Duration("timeout", 30*time.Second, "HTTP request timeout")
-	userAgent := flag.String("user-agent", "GoScraper/1.0", "User-Agent for HTTP requests")
-	flag.Parse()
-
-	return Config{
-		DBPath:      *dbPath,
-		Concurrency: *concurrency,
-		Timeout:     *timeout,
-		UserAgent:   *userAgent,
+	var transport http.RoundTripper = base
+
+	// Scrape recorded fixtures offline. Unrecorded pages, robots.txt
+	// included, answer 404.
+	var fixtures *fetch.Fixtures
+	if config.ReplayDir != "" {
+		fixtures, err = fetch.LoadFixtures(config.ReplayDir)
+		if err != nil {
+			fatal(logger, "Failed to load fixtures", "error", err)
+		}
+		transport = &fetch.ReplayTransport{Fixtures: fixtures}
+		logger.Info("Replaying recorded pages", "dir", config.ReplayDir, "count", len(fixtures.Pages()))
 	}
-}
-
-func getURLsToScrape() []string {
-	// In a real application, you might load these from a file or API
-	baseURL := "https://news.ycombinator.com/news?p="
-	urls := make([]string, 0, 30)
 
-	// Add main HN page
-	urls = append(urls, "https://news.ycombinator.com/")
+	// Rotate through the configured proxies, evicting those that keep failing
+	if len(config.Proxy.URLs) > 0 && config.ReplayDir == "" {
+		pool, err := fetch.NewProxyPool(config.Proxy, logger)
+		if err != nil {
+			fatal(logger, "Invalid proxy configuration", "error", err)
+		}
+		base.Proxy = fetch.ProxyFromContext
+		transport = &fetch.ProxyTransport{Base: base, Pool: pool}
 
-	// Add multiple pages of HN
-	for i := 2; i <= 30; i++ {
-		urls = append(urls, fmt.Sprintf("%s%d", baseURL, i))
+		if config.Proxy.CheckURL != "" {
+			pool.CheckHealth(ctx, config.Proxy.CheckURL, config.Timeout)
+			if pool.Healthy() == 0 {
+				fatal(logger, "No proxy passed its health check", "check_url", config.Proxy.CheckURL)
+			}
+			if interval := config.Proxy.HealthCheckInterval(); interval > 0 {
+				go pool.RunHealthChecks(ctx, config.Proxy.CheckURL, interval, config.Timeout)
+			}
+		}
+		logger.Info("Using proxies", "count", len(config.Proxy.URLs), "healthy", pool.Healthy(), "rotation", config.Proxy.Rotation)
 	}
-
-	return urls
-}
-
-// Initialize the SQLite DB
-func initDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	if config.run.Metrics != nil {
+		transport = &fetch.MetricsTransport{Base: transport, Metrics: config.run.Metrics}
 	}
-
-	// Set connection pool parameters
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
-
-	// Verify database connection
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	client := &http.Client{
+		Timeout:   config.Timeout,
+		Transport: &fetch.RateLimitedTransport{Base: transport, Limiter: limiter},
 	}
 
-	return db, nil
-}
-
-// Create a table to store scraped titles
-func createTable(db *sql.DB) error {
-	query := `CREATE TABLE IF NOT EXISTS titles (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		title TEXT NOT NULL,
-		url TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	CREATE INDEX IF NOT EXISTS idx_url ON titles(url);`
-
-	_, err := db.Exec(query)
-	if err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
+	// Serve unchanged pages from the on-disk cache. It wraps the rate limiter
+	// so fresh cache hits don't use up a host's request budget.
+	if config.CacheDir != "" {
+		cache, err := fetch.NewCache(config.CacheDir, config.CacheMaxAge)
+		if err != nil {
+			fatal(logger, "Failed to open cache", "error", err)
+		}
+		client.Transport = &fetch.CachingTransport{Base: client.Transport, Cache: cache}
 	}
-	return nil
-}
-
-// Process URLs using a worker pool pattern
-func processURLs(ctx context.Context, urls []string, db *sql.DB, client *http.Client, config Config, logger *log.Logger) error {
-	totalURLs := len(urls)
-	logger.Printf("Starting to process %d URLs with %d workers", totalURLs, config.Concurrency)
 
-	// Create job channel and initialize worker pool
-	jobs := make(chan string, totalURLs)
-	results := make(chan ScrapedItem, totalURLs*30) // Each page might have multiple items
-	errors := make(chan error, totalURLs)
-
-	// Create a new WaitGroup for workers
-	var wg sync.WaitGroup
-
-	// Create tx stmt once for reuse
-	stmt, err := db.Prepare("INSERT INTO titles (title, url) VALUES (?, ?)")
-	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
-	}
-	defer stmt.Close()
-
-	// Start the worker pool
-	for i := 0; i < config.Concurrency; i++ {
-		wg.Add(1)
-		go func(workerId int) {
-			defer wg.Done()
-			worker(ctx, workerId, jobs, results, errors, client, config, logger)
-		}(i)
+	// Sites serving empty HTML shells are fetched through a rendering service
+	if config.Sites.needsRenderer() {
+		if config.RenderURL == "" {
+			fatal(logger, "A site uses fetcher: render but -render-url is not set")
+		}
+		render := &fetch.RenderFetcher{Endpoint: config.RenderURL, Client: client, Options: config.run.Fetch}
+		config.run.Fetchers = newFetcherRegistry(config.Sites, render)
 	}
 
-	// Database writer goroutine
-	var dbWg sync.WaitGroup
-	dbWg.Add(1)
-	go func() {
-		defer dbWg.Done()
-		processResults(ctx, results, stmt, logger)
-	}()
+	// Honor robots.txt (including Crawl-delay) unless told otherwise
+	if !config.IgnoreRobots {
+		config.run.Robots = fetch.NewRobotsCache(client, config.UserAgent, limiter)
+	}
 
-	// Error handler goroutine
-	var errWg sync.WaitGroup
-	errWg.Add(1)
-	go func() {
-		defer errWg.Done()
-		for err := range errors {
-			logger.Printf("Error: %v", err)
+	// In daemon mode, scrape each site on its own schedule until interrupted
+	if config.Daemon {
+		// A resumed queue belongs to a one-off run, scheduled runs start fresh
+		config.run.Resume = false
+		if err := runDaemon(ctx, db, client, config, logger); err != nil {
+			fatal(logger, "Daemon failed", "error", err)
 		}
-	}()
+		logger.Info("Daemon stopped")
+		return
+	}
 
-	// Send jobs to workers
-	go func() {
-		for _, url := range urls {
-			select {
-			case <-ctx.Done():
-				break
-			case jobs <- url:
-				// Job sent
-			}
+	// URLs to scrape, expanded from each site's seeds, pagination rule and
+	// sources, the recorded pages when replaying without a config, or the
+	// permanent failures of earlier runs when -retry-failed is set
+	var urls []string
+	switch {
+	case config.RetryFailed:
+		urls, err = pipeline.FailedURLs(db)
+		if err != nil {
+			fatal(logger, "Failed to load failed URLs", "error", err)
 		}
-		close(jobs)
-	}()
-
-	// Wait for all workers to complete
-	wg.Wait()
-	close(results)
-	close(errors)
-
-	// Wait for the DB writer to finish
-	dbWg.Wait()
-	errWg.Wait()
-
-	return nil
-}
+	case fixtures != nil && config.ConfigPath == "":
+		urls = fixtures.URLs()
+	default:
+		urls = getURLsToScrape(ctx, config.Sites, client, config.run.Fetch, logger)
+	}
 
-// Worker processes URLs from the jobs channel
-func worker(ctx context.Context, id int, jobs <-chan string, results chan<- ScrapedItem, errors chan<- error, client *http.Client, config Config, logger *log.Logger) {
-	for url := range jobs {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			logger.Printf("Worker %d processing %s", id, url)
-			items, err := scrapeURL(ctx, url, client, config)
-			if err != nil {
-				errors <- fmt.Errorf("worker %d failed to scrape %s: %w", id, url, err)
-				continue
-			}
+	// Process URLs with worker pool pattern
+	summary, err := scrapeSites(ctx, config.Sites.Sites, urls, db, client, config.run, logger)
+	if err != nil {
+		fatal(logger, "Error processing URLs", "error", err)
+	}
 
-			// Send all scraped items to results channel
-			for _, item := range items {
-				select {
-				case <-ctx.Done():
-					return
-				case results <- item:
-					// Result sent
-				}
-			}
-		}
+	// The report goes to stderr since stdout may be an output sink; it is
+	// also saved with the run, see `scraper runs`
+	fmt.Fprintln(os.Stderr)
+	if err := summary.Report.WriteTable(os.Stderr); err != nil {
+		logger.Error("Failed to print run report", "error", err)
 	}
-}
 
-// Process results and save to database
-func processResults(ctx context.Context, results <-chan ScrapedItem, stmt *sql.Stmt, logger *log.Logger) {
-	count := 0
-	for item := range results {
-		select {
-		case <-ctx.Done():
-			logger.Println("Context canceled, stopping result processing")
-			return
-		default:
-			if err := insertTitle(stmt, item); err != nil {
-				logger.Printf("Failed to insert item: %v", err)
-			} else {
-				count++
-				if count%100 == 0 {
-					logger.Printf("Processed %d items so far", count)
-				}
-			}
-		}
+	if ctx.Err() != nil {
+		logger.Info("Scraping stopped early, everything scraped so far was saved")
+		return
 	}
-	logger.Printf("Total items saved to database: %d", count)
+	logger.Info("Scraping completed successfully")
 }
 
-// Scrape a URL for titles
-func scrapeURL(ctx context.Context, url string, client *http.Client, config Config) ([]ScrapedItem, error) {
-	// Create a request with context
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+func parseFlags() Config {
+	dbPath := flag.String("db", "./scraped_titles.db", "Path to SQLite database file")
+	configPath := flag.String("config", "", "Path to a JSON or YAML site config (defaults to Hacker News)")
+	concurrency := flag.Int("concurrency", 10, "Number of concurrent scrapers")
+	timeout := flag.Duration("timeout", 30*time.Second, "HTTP request timeout")
+	hostRate := flag.Float64("host-rate", 2, "Maximum requests per second per host (0 = unlimited)")
+	hostBurst := flag.Int("host-burst", 2, "Burst size of the per-host rate limiter")
+	hostMinDelay := flag.Duration("host-min-delay", 0, "Minimum delay between requests to the same host")
+	hostConcurrency := flag.Int("host-concurrency", 4, "Maximum concurrent requests per host (0 = unlimited)")
+	userAgent := flag.String("user-agent", "GoScraper/1.0", "User-Agent for HTTP requests")
+	maxRetries := flag.Int("retries", 3, "Number of retries for transient transport errors, 429 and 500/502/503/504 responses")
+	retryBase := flag.Duration("retry-base-delay", 500*time.Millisecond, "Base delay for exponential retry backoff")
+	retryMax := flag.Duration("retry-max-delay", 30*time.Second, "Maximum delay between retries, including Retry-After")
+	crawl := flag.Bool("crawl", false, "Follow same-host links discovered on scraped pages")
+	maxDepth := flag.Int("max-depth", 2, "Maximum link depth from the seed URLs in crawl mode")
+	maxPages := flag.Int("max-pages", 500, "Maximum number of pages to scrape (0 = unlimited)")
+	resume := flag.Bool("resume", false, "Continue the URL queue left by an interrupted run")
+	ignoreRobots := flag.Bool("ignore-robots", false, "Skip robots.txt checks (only for sites you own)")
+	retryFailed := flag.Bool("retry-failed", false, "Scrape the URLs recorded in failed_urls instead of the configured sites")
+	batchSize := flag.Int("batch-size", 100, "Number of items written per output transaction")
+	flushInterval := flag.Duration("flush-interval", time.Second, "Maximum time to hold a partial batch before writing it")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "How long in-flight pages may finish after Ctrl+C")
+	cacheDir := flag.String("cache-dir", "", "Directory for the HTTP response cache (empty = disabled)")
+	cacheMaxAge := flag.Duration("cache-max-age", 0, "Reuse cached pages younger than this without revalidating")
+	purgeCache := flag.Bool("purge-cache", false, "Delete everything in -cache-dir and exit")
+	daemon := flag.Bool("daemon", false, "Run continuously, scraping each site on its cron schedule")
+	logFormat := flag.String("log-format", "json", "Log output format: json or text")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	replayDir := flag.String("replay", "", "Scrape pages recorded with `scraper record` in this directory instead of the network")
+	renderURL := flag.String("render-url", "", "Rendering service for sites with fetcher: render, {url} is replaced with the page URL")
+	var proxies, userAgents stringList
+	flag.Var(&proxies, "proxy", "Proxy URL (http://, https:// or socks5://), repeatable")
+	flag.Var(&userAgents, "user-agent-pool", "User-Agent to pick from at random per request, repeatable")
+	proxyRotation := flag.String("proxy-rotation", "", "Rotate proxies per \"request\" (default) or per \"host\"")
+	proxyMaxFailures := flag.Int("proxy-max-failures", 0, "Consecutive failures before a proxy is evicted (default 3)")
+	proxyCheckURL := flag.String("proxy-check-url", "", "URL fetched through each proxy to check its health (empty = no checks)")
+	proxyCheckInterval := flag.Duration("proxy-check-interval", 0, "How often to re-check proxies, restoring healthy ones (default 5m, negative disables)")
+	articles := flag.Bool("articles", false, "Fetch each item's outbound link and save its article text to the articles table")
+	articleConcurrency := flag.Int("article-concurrency", 4, "Number of workers fetching articles")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9090 (empty = disabled)")
+	schedule := flag.String("schedule", "", "Cron schedule for sites without one in the config, e.g. \"*/30 * * * *\"")
+	var outputs stringList
+	flag.Var(&outputs, "output", "Output sink, repeatable: sqlite, stdout, csv:PATH, jsonl:PATH or postgres:DSN (default sqlite)")
+	flag.Parse()
 
-	// Set headers to mimic a browser
-	req.Header.Set("User-Agent", config.UserAgent)
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	return Config{
+		DBPath:      *dbPath,
+		ConfigPath:  *configPath,
+		Concurrency: *concurrency,
+		Timeout:     *timeout,
+		UserAgent:   *userAgent,
+		UserAgents:  userAgents,
+
+		Proxy: fetch.ProxyConfig{
+			URLs:          proxies,
+			Rotation:      *proxyRotation,
+			MaxFailures:   *proxyMaxFailures,
+			CheckURL:      *proxyCheckURL,
+			CheckInterval: fetch.Duration(*proxyCheckInterval),
+		},
 
-	// Send the request
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+		MaxRetries:     *maxRetries,
+		RetryBaseDelay: *retryBase,
+		RetryMaxDelay:  *retryMax,
+		RetryFailed:    *retryFailed,
+
+		Crawl:    *crawl,
+		MaxDepth: *maxDepth,
+		MaxPages: *maxPages,
+		Resume:   *resume,
+
+		Articles:           *articles,
+		ArticleConcurrency: *articleConcurrency,
+
+		Outputs:       outputs,
+		BatchSize:     *batchSize,
+		FlushInterval: *flushInterval,
+
+		CacheDir:    *cacheDir,
+		CacheMaxAge: *cacheMaxAge,
+		PurgeCache:  *purgeCache,
+
+		Daemon:          *daemon,
+		DefaultSchedule: *schedule,
+		ShutdownTimeout: *shutdownTimeout,
+
+		IgnoreRobots: *ignoreRobots,
+		MetricsAddr:  *metricsAddr,
+		RenderURL:    *renderURL,
+		ReplayDir:    *replayDir,
+		LogFormat:    *logFormat,
+		LogLevel:     *logLevel,
+
+		Politeness: fetch.Politeness{
+			Rate:           *hostRate,
+			Burst:          *hostBurst,
+			MinDelay:       *hostMinDelay,
+			MaxConcurrency: *hostConcurrency,
+		},
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
+// getURLsToScrape lists the pages of every site, see siteURLs
+func getURLsToScrape(ctx context.Context, sites SitesConfig, client *http.Client, opts fetch.Options, logger *slog.Logger) []string {
+	var urls []string
+	for _, site := range sites.Sites {
+		urls = append(urls, siteURLs(ctx, site, client, opts, logger)...)
 	}
+	return urls
+}
 
-	// Parse the HTML document
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+// pipelineConfig returns the run settings taken from the flags
+func (c Config) pipelineConfig() pipeline.Config {
+	return pipeline.Config{
+		Concurrency: c.Concurrency,
+		Fetch: fetch.Options{
+			UserAgent:      c.UserAgent,
+			UserAgents:     c.UserAgents,
+			MaxRetries:     c.MaxRetries,
+			RetryBaseDelay: c.RetryBaseDelay,
+			RetryMaxDelay:  c.RetryMaxDelay,
+		},
+		Crawl:              c.Crawl,
+		MaxDepth:           c.MaxDepth,
+		MaxPages:           c.MaxPages,
+		Resume:             c.Resume,
+		Outputs:            c.Outputs,
+		BatchSize:          c.BatchSize,
+		FlushInterval:      c.FlushInterval,
+		ShutdownTimeout:    c.ShutdownTimeout,
+		Articles:           c.Articles,
+		ArticleConcurrency: c.ArticleConcurrency,
 	}
+}
 
-	var items []ScrapedItem
-
-	// For Hacker News, find story titles (adjust selector as needed)
-	doc.Find(".titleline > a").Each(func(i int, s *goquery.Selection) {
-		title := s.Text()
-		href, exists := s.Attr("href")
-
-		if exists && title != "" {
-			item := ScrapedItem{
-				Title: title,
-				URL:   href,
-			}
-			items = append(items, item)
-		}
-	})
-
-	if len(items) == 0 {
-		// Fallback to generic title if no stories found
-		title := doc.Find("title").Text()
-		if title != "" {
-			items = append(items, ScrapedItem{
-				Title: title,
-				URL:   url,
-			})
-		}
-	}
+// stringList collects the values of a repeatable flag
+type stringList []string
 
-	return items, nil
+func (o *stringList) String() string {
+	return strings.Join(*o, ",")
 }
 
-// Insert a scraped title into the SQLite DB
-func insertTitle(stmt *sql.Stmt, item ScrapedItem) error {
-	_, err := stmt.Exec(item.Title, item.URL)
-	if err != nil {
-		return fmt.Errorf("failed to insert title: %w", err)
-	}
+func (o *stringList) Set(value string) error {
+	*o = append(*o, value)
 	return nil
 }
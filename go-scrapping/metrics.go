@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/pipeline"
+)
+
+// serveMetrics exposes /metrics on addr in the background. The returned
+// server should be closed on exit.
+func serveMetrics(addr string, metrics *pipeline.Metrics, logger *slog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		logger.Info("Serving metrics", "addr", addr, "path", "/metrics")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal(logger, "Metrics server failed", "error", err)
+		}
+	}()
+	return srv
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+// runMigrate implements `scraper migrate [flags] up|down|status`
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbPath := fs.String("db", "./scraped_titles.db", "Path to SQLite database file")
+	to := fs.Int("to", -1, "Target version: up applies migrations up to it (default all), down rolls back those above it (default the latest one)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s migrate [flags] up|down|status\n\nApplies or rolls back schema migrations. The scraper applies pending\nmigrations on startup, so up is only needed to prepare a database.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one of up, down or status")
+	}
+
+	db, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch fs.Arg(0) {
+	case "up":
+		target := max(*to, 0)
+		applied, err := store.MigrateUp(db, target)
+		printMigrations(os.Stdout, "Applied", applied)
+		return err
+	case "down":
+		target := *to
+		if target < 0 {
+			current, err := store.CurrentVersion(db)
+			if err != nil {
+				return err
+			}
+			target, err = previousVersion(current)
+			if err != nil {
+				return err
+			}
+		}
+		rolledBack, err := store.MigrateDown(db, target)
+		printMigrations(os.Stdout, "Rolled back", rolledBack)
+		return err
+	case "status":
+		statuses, err := store.MigrationStatuses(db)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(os.Stdout, statuses)
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", fs.Arg(0))
+	}
+}
+
+// previousVersion returns the migration before version, 0 if it is the first
+func previousVersion(version int) (int, error) {
+	migrations, err := store.Migrations()
+	if err != nil {
+		return 0, err
+	}
+	previous := 0
+	for _, m := range migrations {
+		if m.Version >= version {
+			break
+		}
+		previous = m.Version
+	}
+	return previous, nil
+}
+
+func printMigrations(w io.Writer, verb string, migrations []store.Migration) {
+	if len(migrations) == 0 {
+		fmt.Fprintln(w, "Nothing to do, the schema is already at the target version")
+		return
+	}
+	for _, m := range migrations {
+		fmt.Fprintf(w, "%s %04d_%s\n", verb, m.Version, m.Name)
+	}
+}
+
+func printMigrationStatus(w io.Writer, statuses []store.MigrationStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		status := "pending"
+		if s.Applied {
+			status = "applied"
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, status, s.AppliedAt)
+	}
+	tw.Flush()
+}
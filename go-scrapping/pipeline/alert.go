@@ -0,0 +1,498 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/store"
+	"github.com/gen2brain/beeep"
+	"gopkg.in/gomail.v2"
+)
+
+// notifyTimeout bounds each notification, which also goes out after an
+// interrupt so the items already saved aren't left unannounced
+const notifyTimeout = 30 * time.Second
+
+// AlertConfig is the "alerts" section of the site config: a watchlist and
+// the channels matches are sent to
+type AlertConfig struct {
+	Watch []WatchRule `json:"watch,omitempty" yaml:"watch,omitempty"`
+
+	// Digest sends one notification per run with every match instead of
+	// one per batch of new items
+	Digest bool `json:"digest,omitempty" yaml:"digest,omitempty"`
+
+	Webhook *WebhookConfig `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+	Email   *EmailConfig   `json:"email,omitempty" yaml:"email,omitempty"`
+	Desktop bool           `json:"desktop,omitempty" yaml:"desktop,omitempty"`
+}
+
+// WatchRule matches items whose title or URL contains any keyword (case
+// insensitive) or matches any pattern (Go regexp syntax)
+type WatchRule struct {
+	Name     string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Keywords []string `json:"keywords,omitempty" yaml:"keywords,omitempty"`
+	Patterns []string `json:"patterns,omitempty" yaml:"patterns,omitempty"`
+}
+
+// WebhookConfig posts matches as JSON. The "text" field makes the payload
+// usable as-is by Slack and Mattermost incoming webhooks.
+type WebhookConfig struct {
+	URL string `json:"url" yaml:"url"`
+}
+
+// EmailConfig sends matches over SMTP. The password is read from the
+// PasswordEnv environment variable so it stays out of the config file.
+type EmailConfig struct {
+	Host        string   `json:"host" yaml:"host"`
+	Port        int      `json:"port,omitempty" yaml:"port,omitempty"`
+	Username    string   `json:"username,omitempty" yaml:"username,omitempty"`
+	PasswordEnv string   `json:"password_env,omitempty" yaml:"password_env,omitempty"`
+	From        string   `json:"from" yaml:"from"`
+	To          []string `json:"to" yaml:"to"`
+}
+
+// AlertMatch is a new item that matched a watch rule
+type AlertMatch struct {
+	Rule  string `json:"rule"`
+	Site  string `json:"site"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Notifier delivers matches over one channel
+type Notifier interface {
+	Notify(ctx context.Context, matches []AlertMatch) error
+}
+
+type watchRule struct {
+	name     string
+	keywords []string // lowercased
+	patterns []*regexp.Regexp
+}
+
+func (r watchRule) matches(item extract.Item) bool {
+	title, url := strings.ToLower(item.Title), strings.ToLower(item.URL)
+	for _, kw := range r.keywords {
+		if strings.Contains(title, kw) || strings.Contains(url, kw) {
+			return true
+		}
+	}
+	for _, re := range r.patterns {
+		if re.MatchString(item.Title) || re.MatchString(item.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+// Alerter holds the compiled watchlist and notifiers
+type Alerter struct {
+	rules     []watchRule
+	notifiers []Notifier
+	digest    bool
+}
+
+// NewAlerter compiles the watchlist and sets up its channels. It returns
+// nil when there is nothing to watch.
+func NewAlerter(cfg AlertConfig) (*Alerter, error) {
+	if len(cfg.Watch) == 0 {
+		return nil, nil
+	}
+
+	a := &Alerter{digest: cfg.Digest}
+	for i, rule := range cfg.Watch {
+		r := watchRule{name: rule.Name}
+		for _, kw := range rule.Keywords {
+			if kw = strings.TrimSpace(kw); kw != "" {
+				r.keywords = append(r.keywords, strings.ToLower(kw))
+			}
+		}
+		for _, p := range rule.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("watch rule %d: invalid pattern %q: %w", i, p, err)
+			}
+			r.patterns = append(r.patterns, re)
+		}
+		if len(r.keywords) == 0 && len(r.patterns) == 0 {
+			return nil, fmt.Errorf("watch rule %d has no keywords or patterns", i)
+		}
+		if r.name == "" {
+			r.name = strings.Join(append(append([]string(nil), rule.Keywords...), rule.Patterns...), ", ")
+		}
+		a.rules = append(a.rules, r)
+	}
+
+	if cfg.Webhook != nil {
+		if cfg.Webhook.URL == "" {
+			return nil, errors.New("alert webhook has no url")
+		}
+		a.notifiers = append(a.notifiers, &webhookNotifier{url: cfg.Webhook.URL, client: &http.Client{Timeout: notifyTimeout}})
+	}
+	if cfg.Email != nil {
+		n, err := newEmailNotifier(*cfg.Email)
+		if err != nil {
+			return nil, err
+		}
+		a.notifiers = append(a.notifiers, n)
+	}
+	if cfg.Desktop {
+		a.notifiers = append(a.notifiers, desktopNotifier{})
+	}
+	if len(a.notifiers) == 0 {
+		return nil, errors.New("alerts have a watchlist but no webhook, email or desktop channel")
+	}
+	return a, nil
+}
+
+// Match returns an AlertMatch for every item matching a rule, naming the
+// first rule it matched
+func (a *Alerter) Match(items []extract.Item) []AlertMatch {
+	var matches []AlertMatch
+	for _, item := range items {
+		for _, r := range a.rules {
+			if r.matches(item) {
+				matches = append(matches, AlertMatch{Rule: r.name, Site: item.Site, Title: item.Title, URL: item.URL})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// notify sends matches over every channel. It only fails when no channel
+// delivered them, so a broken channel doesn't make the others repeat alerts.
+func (a *Alerter) notify(matches []AlertMatch, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, n := range a.notifiers {
+		if err := n.Notify(ctx, matches); err != nil {
+			logger.Error("Failed to send alert", "channel", fmt.Sprintf("%T", n), "error", err)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(a.notifiers) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// alertSink checks every saved batch against the watchlist. The alerts table
+// remembers which stories were claimed and which of them were sent, so each
+// one alerts only once across runs. Notifications go out from their own
+// goroutine so a slow channel doesn't hold up the DB writer; matches claimed
+// while one is being sent are sent together next. Claims that weren't sent,
+// because every channel failed or the run stopped first, are sent again by
+// the next sink. Alert failures are logged rather than returned since the
+// items themselves were stored.
+type alertSink struct {
+	db      *sql.DB
+	alerter *Alerter
+	logger  *slog.Logger
+
+	mu     sync.Mutex
+	queued []AlertMatch // claimed but not sent yet; digest mode sends them on Close
+	closed bool
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+func newAlertSink(db *sql.DB, a *Alerter, logger *slog.Logger) *alertSink {
+	s := &alertSink{
+		db:      db,
+		alerter: a,
+		logger:  logger.With("stage", "alerts"),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	unsent, err := s.unsent()
+	if err != nil {
+		s.logger.Error("Failed to load unsent alerts", "error", err)
+	}
+	s.queued = unsent
+	go s.run()
+	if len(unsent) > 0 && !a.digest {
+		s.signal()
+	}
+	return s
+}
+
+func (s *alertSink) WriteBatch(items []extract.Item) error {
+	matches, err := s.claim(s.alerter.Match(items))
+	if err != nil {
+		s.logger.Error("Failed to record alerts", "error", err)
+		return nil
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.queued = append(s.queued, matches...)
+	s.mu.Unlock()
+	if !s.alerter.digest {
+		s.signal()
+	}
+	return nil
+}
+
+// Close sends whatever is still queued and waits for it to go out
+func (s *alertSink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.signal()
+	<-s.done
+	return nil
+}
+
+func (s *alertSink) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends queued matches until the sink is closed and nothing is left
+func (s *alertSink) run() {
+	defer close(s.done)
+	for range s.wake {
+		s.mu.Lock()
+		matches, closed := s.queued, s.closed
+		s.queued = nil
+		s.mu.Unlock()
+
+		if len(matches) > 0 {
+			s.send(matches)
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+func (s *alertSink) send(matches []AlertMatch) {
+	if err := s.alerter.notify(matches, s.logger); err != nil {
+		// The claims stay unsent, so the next run tries these stories again
+		return
+	}
+	if err := s.markSent(matches); err != nil {
+		s.logger.Error("Failed to record sent alerts", "error", err)
+	}
+	s.logger.Info("Sent alerts", "match_count", len(matches))
+}
+
+// claim records matches in the alerts table and returns those not claimed
+// before
+func (s *alertSink) claim(matches []AlertMatch) ([]AlertMatch, error) {
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var fresh []AlertMatch
+	for _, m := range matches {
+		res, err := tx.Exec(`INSERT INTO alerts (url_key, rule, site, title, url) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(url_key) DO NOTHING`, store.NormalizeURL(m.URL), m.Rule, m.Site, m.Title, m.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert alert: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			fresh = append(fresh, m)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit alerts: %w", err)
+	}
+	return fresh, nil
+}
+
+// unsent returns the claimed matches no notification went out for
+func (s *alertSink) unsent() ([]AlertMatch, error) {
+	rows, err := s.db.Query(`SELECT rule, COALESCE(site, ''), COALESCE(title, ''), url
+		FROM alerts WHERE sent_at IS NULL ORDER BY alerted_at, rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unsent alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []AlertMatch
+	for rows.Next() {
+		var m AlertMatch
+		if err := rows.Scan(&m.Rule, &m.Site, &m.Title, &m.URL); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+func (s *alertSink) markSent(matches []AlertMatch) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, m := range matches {
+		_, err := tx.Exec("UPDATE alerts SET sent_at = CURRENT_TIMESTAMP WHERE url_key = ?", store.NormalizeURL(m.URL))
+		if err != nil {
+			return fmt.Errorf("failed to update alert: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// alertingSink writes batches to its sink and checks them against the
+// watchlist only once they were stored, so no alert announces a lost item
+type alertingSink struct {
+	store.Sink
+	alerts *alertSink
+}
+
+func (s alertingSink) WriteBatch(items []extract.Item) error {
+	if err := s.Sink.WriteBatch(items); err != nil {
+		return err
+	}
+	return s.alerts.WriteBatch(items)
+}
+
+func (s alertingSink) Close() error {
+	return errors.Join(s.Sink.Close(), s.alerts.Close())
+}
+
+// alertSubject summarizes matches in one line
+func alertSubject(matches []AlertMatch) string {
+	if len(matches) == 1 {
+		return fmt.Sprintf("Watchlist match: %s", matches[0].Title)
+	}
+	return fmt.Sprintf("%d new stories matched your watchlist", len(matches))
+}
+
+// alertBody lists matches as plain text
+func alertBody(matches []AlertMatch) string {
+	var b strings.Builder
+	for _, m := range matches {
+		fmt.Fprintf(&b, "[%s] %s (%s)\n%s\n", m.Rule, m.Title, m.Site, m.URL)
+	}
+	return b.String()
+}
+
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, matches []AlertMatch) error {
+	body, err := json.Marshal(map[string]any{
+		"text":    alertSubject(matches) + "\n" + alertBody(matches),
+		"matches": matches,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+type emailNotifier struct {
+	dialer *gomail.Dialer
+	from   string
+	to     []string
+}
+
+func newEmailNotifier(cfg EmailConfig) (*emailNotifier, error) {
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("alert email needs host, from and to")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	var password string
+	if cfg.PasswordEnv != "" {
+		password = os.Getenv(cfg.PasswordEnv)
+		if password == "" {
+			return nil, fmt.Errorf("alert email password variable %s is not set", cfg.PasswordEnv)
+		}
+	}
+	return &emailNotifier{
+		dialer: gomail.NewDialer(cfg.Host, cfg.Port, cfg.Username, password),
+		from:   cfg.From,
+		to:     cfg.To,
+	}, nil
+}
+
+// Notify sends one email. gomail has no context support, so the send runs
+// in the background and Notify gives up on it once ctx is done.
+func (n *emailNotifier) Notify(ctx context.Context, matches []AlertMatch) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", n.from)
+	m.SetHeader("To", n.to...)
+	m.SetHeader("Subject", alertSubject(matches))
+	m.SetBody("text/plain", alertBody(matches))
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- n.dialer.DialAndSend(m)
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to send email: %w", ctx.Err())
+	}
+}
+
+// desktopNotifier shows a notification on the machine running the scraper
+type desktopNotifier struct{}
+
+func (desktopNotifier) Notify(ctx context.Context, matches []AlertMatch) error {
+	body := alertBody(matches)
+	if len(matches) > 1 {
+		// Notification popups truncate long text, so just list the titles
+		titles := make([]string, len(matches))
+		for i, m := range matches {
+			titles[i] = m.Title
+		}
+		body = strings.Join(titles, "\n")
+	}
+	if err := beeep.Notify(alertSubject(matches), body, ""); err != nil {
+		return fmt.Errorf("failed to show notification: %w", err)
+	}
+	return nil
+}
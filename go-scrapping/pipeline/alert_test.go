@@ -0,0 +1,249 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+)
+
+// recordingNotifier keeps every notification it was sent
+type recordingNotifier struct {
+	mu    sync.Mutex
+	calls [][]AlertMatch
+	err   error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, matches []AlertMatch) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls = append(n.calls, matches)
+	return n.err
+}
+
+func newTestAlerter(t *testing.T, cfg AlertConfig, n Notifier) *Alerter {
+	t.Helper()
+	cfg.Desktop = true // any channel, replaced below
+	a, err := NewAlerter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.notifiers = []Notifier{n}
+	return a
+}
+
+var testWatch = []WatchRule{
+	{Name: "ours", Keywords: []string{"Postgres"}},
+	{Patterns: []string{`(?i)\brust\b`}},
+}
+
+func TestAlerterMatch(t *testing.T) {
+	a := newTestAlerter(t, AlertConfig{Watch: testWatch}, &recordingNotifier{})
+
+	matches := a.Match([]extract.Item{
+		{Title: "Why we left POSTGRES", URL: "https://a.test/1"},
+		{Title: "Rust 2.0 released", URL: "https://b.test/2"},
+		{Title: "Trusting trust", URL: "https://c.test/3"},
+		{Title: "Unrelated", URL: "https://postgres.example/blog"},
+	})
+
+	want := []string{"ours", `(?i)\brust\b`, "ours"}
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d: %+v", len(matches), len(want), matches)
+	}
+	for i, m := range matches {
+		if m.Rule != want[i] {
+			t.Errorf("match %d rule = %q, want %q", i, m.Rule, want[i])
+		}
+	}
+}
+
+func TestNewAlerterRejectsBadConfig(t *testing.T) {
+	for name, cfg := range map[string]AlertConfig{
+		"no channel":     {Watch: testWatch},
+		"empty rule":     {Watch: []WatchRule{{Name: "x"}}, Desktop: true},
+		"bad pattern":    {Watch: []WatchRule{{Patterns: []string{"("}}}, Desktop: true},
+		"webhook no url": {Watch: testWatch, Webhook: &WebhookConfig{}},
+	} {
+		if _, err := NewAlerter(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if a, err := NewAlerter(AlertConfig{}); a != nil || err != nil {
+		t.Errorf("empty config = %v, %v, want nil, nil", a, err)
+	}
+}
+
+func TestAlertSinkAlertsOnce(t *testing.T) {
+	db := newTestDB(t)
+	n := &recordingNotifier{}
+	a := newTestAlerter(t, AlertConfig{Watch: testWatch}, n)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	items := []extract.Item{{Title: "Postgres tips", URL: "https://a.test/1"}}
+
+	for run := 0; run < 2; run++ {
+		sink := newAlertSink(db, a, logger)
+		sink.WriteBatch(items)
+		sink.WriteBatch(items)
+		sink.Close()
+	}
+	if len(n.calls) != 1 {
+		t.Errorf("notified %d times, want once", len(n.calls))
+	}
+}
+
+func TestAlertSinkDigest(t *testing.T) {
+	db := newTestDB(t)
+	n := &recordingNotifier{}
+	a := newTestAlerter(t, AlertConfig{Watch: testWatch, Digest: true}, n)
+	sink := newAlertSink(db, a, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	sink.WriteBatch([]extract.Item{{Title: "Postgres tips", URL: "https://a.test/1"}})
+	sink.WriteBatch([]extract.Item{{Title: "Rust news", URL: "https://a.test/2"}, {Title: "Other", URL: "https://a.test/3"}})
+	if len(n.calls) != 0 {
+		t.Fatal("digest mode notified before the run ended")
+	}
+	sink.Close()
+
+	if len(n.calls) != 1 || len(n.calls[0]) != 2 {
+		t.Errorf("notifications = %+v, want one with 2 matches", n.calls)
+	}
+}
+
+func TestAlertSinkRetriesFailedNotifications(t *testing.T) {
+	db := newTestDB(t)
+	n := &recordingNotifier{}
+	a := newTestAlerter(t, AlertConfig{Watch: testWatch}, n)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	items := []extract.Item{{Title: "Postgres tips", URL: "https://a.test/1"}}
+
+	for _, err := range []error{errors.New("channel down"), nil} {
+		n.err = err
+		sink := newAlertSink(db, a, logger)
+		sink.WriteBatch(items)
+		sink.Close()
+	}
+
+	if len(n.calls) != 2 {
+		t.Errorf("notified %d times, want a retry after the failure", len(n.calls))
+	}
+}
+
+func TestAlertSinkSendsDigestLeftByStoppedRun(t *testing.T) {
+	db := newTestDB(t)
+	n := &recordingNotifier{}
+	a := newTestAlerter(t, AlertConfig{Watch: testWatch, Digest: true}, n)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// The run stops before its digest is sent on Close
+	stopped := newAlertSink(db, a, logger)
+	stopped.WriteBatch([]extract.Item{{Title: "Postgres tips", URL: "https://a.test/1"}})
+
+	next := newAlertSink(db, a, logger)
+	next.WriteBatch([]extract.Item{{Title: "Rust news", URL: "https://a.test/2"}})
+	next.Close()
+	if len(n.calls) != 1 || len(n.calls[0]) != 2 {
+		t.Fatalf("notifications = %+v, want one digest with both matches", n.calls)
+	}
+
+	// Once sent, they aren't sent again
+	newAlertSink(db, a, logger).Close()
+	if len(n.calls) != 1 {
+		t.Errorf("notified %d times, want once", len(n.calls))
+	}
+}
+
+// failingSink fails every write
+type failingSink struct{}
+
+func (failingSink) WriteBatch([]extract.Item) error { return errors.New("disk full") }
+func (failingSink) Close() error                    { return nil }
+
+func TestAlertingSinkSkipsBatchesNotStored(t *testing.T) {
+	db := newTestDB(t)
+	n := &recordingNotifier{}
+	a := newTestAlerter(t, AlertConfig{Watch: testWatch}, n)
+	sink := alertingSink{Sink: failingSink{}, alerts: newAlertSink(db, a, slog.New(slog.NewTextHandler(io.Discard, nil)))}
+
+	if err := sink.WriteBatch([]extract.Item{{Title: "Postgres tips", URL: "https://a.test/1"}}); err == nil {
+		t.Error("WriteBatch() = nil, want the sink's error")
+	}
+	sink.Close()
+	if len(n.calls) != 0 {
+		t.Errorf("notifications = %+v, want none for a lost batch", n.calls)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM alerts"); n != 0 {
+		t.Errorf("%d alerts claimed for a lost batch", n)
+	}
+}
+
+// blockingNotifier holds every notification until release is closed
+type blockingNotifier struct {
+	recordingNotifier
+	release chan struct{}
+}
+
+func (n *blockingNotifier) Notify(ctx context.Context, matches []AlertMatch) error {
+	<-n.release
+	return n.recordingNotifier.Notify(ctx, matches)
+}
+
+func TestAlertSinkDoesNotWaitForNotifications(t *testing.T) {
+	db := newTestDB(t)
+	n := &blockingNotifier{release: make(chan struct{})}
+	a := newTestAlerter(t, AlertConfig{Watch: testWatch}, n)
+	sink := newAlertSink(db, a, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Both batches are written while the first notification is stuck
+	sink.WriteBatch([]extract.Item{{Title: "Postgres tips", URL: "https://a.test/1"}})
+	sink.WriteBatch([]extract.Item{{Title: "Rust news", URL: "https://a.test/2"}})
+	close(n.release)
+	sink.Close()
+
+	var sent int
+	for _, call := range n.calls {
+		sent += len(call)
+	}
+	if sent != 2 {
+		t.Errorf("notifications = %+v, want both matches sent by Close", n.calls)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var payload struct {
+		Text    string       `json:"text"`
+		Matches []AlertMatch `json:"matches"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer srv.Close()
+
+	n := &webhookNotifier{url: srv.URL, client: srv.Client()}
+	match := AlertMatch{Rule: "ours", Site: "hn", Title: "Postgres tips", URL: "https://a.test/1"}
+	if err := n.Notify(context.Background(), []AlertMatch{match}); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Matches) != 1 || payload.Matches[0] != match || payload.Text == "" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	n.url = failing.URL
+	if err := n.Notify(context.Background(), []AlertMatch{match}); err == nil {
+		t.Error("expected an error for a 500 response")
+	}
+}
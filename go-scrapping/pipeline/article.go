@@ -0,0 +1,234 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+	"github.com/NoxturneDev/hn-scrapper/store"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxArticleBytes caps how much of an article page is read
+const maxArticleBytes = 5 << 20
+
+// articleQueueSize is how many articles may wait for a worker. Links found
+// while the queue is full are dropped rather than holding up the writer;
+// they have no article yet, so the next run fetches them.
+const articleQueueSize = 1000
+
+// articleStage follows the outbound links of saved items on its own pool of
+// workers and stores their content in the articles table. Items are only
+// enqueued once their titles row is written, so every article has one. A nil
+// *articleStage ignores items.
+type articleStage struct {
+	db     *sql.DB
+	client *http.Client
+	config Config
+	logger *slog.Logger
+
+	jobs    chan extract.Item
+	wg      sync.WaitGroup
+	saved   atomic.Int64
+	dropped atomic.Int64
+
+	mu   sync.Mutex
+	seen map[string]bool // url_keys enqueued this run
+}
+
+func newArticleStage(db *sql.DB, client *http.Client, config Config, logger *slog.Logger) *articleStage {
+	return &articleStage{
+		db:     db,
+		client: client,
+		config: config,
+		logger: logger.With("stage", "articles"),
+		jobs:   make(chan extract.Item, articleQueueSize),
+		seen:   make(map[string]bool),
+	}
+}
+
+// Start runs n workers. Items not yet started when ctx is canceled are
+// dropped; articles being fetched finish on fetchCtx.
+func (s *articleStage) Start(ctx, fetchCtx context.Context, n int) {
+	for i := 0; i < n; i++ {
+		s.wg.Add(1)
+		go func(id int) {
+			defer s.wg.Done()
+			for item := range s.jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				s.process(fetchCtx, id, item)
+			}
+		}(i)
+	}
+}
+
+// Enqueue queues the outbound links among items that haven't been fetched
+// yet. It never blocks: links that don't fit in the queue are dropped.
+func (s *articleStage) Enqueue(items []extract.Item) {
+	if s == nil {
+		return
+	}
+	for _, item := range items {
+		u, err := neturl.Parse(item.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		// Links back to a scraped site (comment pages and the like) aren't articles
+		if s.config.Extractors.Lookup(u) != nil {
+			continue
+		}
+
+		key := store.NormalizeURL(item.URL)
+		s.mu.Lock()
+		dup := s.seen[key]
+		s.seen[key] = true
+		s.mu.Unlock()
+		if dup {
+			continue
+		}
+		select {
+		case s.jobs <- item:
+		default:
+			s.dropped.Add(1)
+			// Let the link be queued again if it turns up later in the run
+			s.mu.Lock()
+			delete(s.seen, key)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close waits for the queued articles and returns how many were saved and
+// how many were dropped because the queue was full
+func (s *articleStage) Close() (saved, dropped int) {
+	if s == nil {
+		return 0, 0
+	}
+	close(s.jobs)
+	s.wg.Wait()
+	return int(s.saved.Load()), int(s.dropped.Load())
+}
+
+func (s *articleStage) process(ctx context.Context, id int, item extract.Item) {
+	key := store.NormalizeURL(item.URL)
+	logger := s.logger.With(logKeyWorkerID, id, logKeyURL, item.URL)
+
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM articles WHERE url_key = ?)", key).Scan(&exists)
+	if err != nil {
+		logger.Error("Failed to look up article", "error", err)
+		return
+	}
+	if exists {
+		return
+	}
+
+	if s.config.Robots != nil {
+		allowed, err := s.config.Robots.Allowed(ctx, item.URL)
+		if err != nil {
+			logger.Warn("Failed to check robots.txt for article", "error", err)
+			return
+		}
+		if !allowed {
+			logger.Debug("Skipping article disallowed by robots.txt")
+			return
+		}
+	}
+
+	start := time.Now()
+	article, status, err := fetchArticle(ctx, item.URL, s.client, s.config)
+	elapsed := time.Since(start)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("Failed to fetch article", logKeyStatus, status, durationAttr(elapsed), "error", err)
+		if err := saveArticleError(s.db, key, item.URL, err); err != nil {
+			logger.Error("Failed to save article", "error", err)
+		}
+		return
+	}
+
+	if err := saveArticle(s.db, key, article); err != nil {
+		logger.Error("Failed to save article", "error", err)
+		return
+	}
+	s.saved.Add(1)
+	logger.Info("Extracted article", logKeyStatus, status, durationAttr(elapsed), "word_count", article.WordCount)
+}
+
+// fetchArticle downloads an HTML page and extracts its article content
+func fetchArticle(ctx context.Context, url string, client *http.Client, config Config) (*extract.Article, int, error) {
+	resp, _, err := fetch.Get(ctx, url, client, config.Fetch)
+	if err != nil {
+		var se *fetch.StatusError
+		if errors.As(err, &se) {
+			return nil, se.StatusCode, err
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, resp.StatusCode, fmt.Errorf("not an HTML page: %s", mediaType)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxArticleBytes))
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	article := extract.ExtractArticle(doc)
+	article.URL = url
+	article.FinalURL = resp.Request.URL.String()
+	return article, resp.StatusCode, nil
+}
+
+func saveArticle(db *sql.DB, urlKey string, a *extract.Article) error {
+	meta, err := json.Marshal(a.Meta)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO articles (url_key, url, final_url, title, author, published_at,
+			description, site_name, image, content, word_count, meta, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(url_key) DO UPDATE SET
+			final_url = excluded.final_url, title = excluded.title, author = excluded.author,
+			published_at = excluded.published_at, description = excluded.description,
+			site_name = excluded.site_name, image = excluded.image, content = excluded.content,
+			word_count = excluded.word_count, meta = excluded.meta,
+			fetched_at = excluded.fetched_at, error = NULL`,
+		urlKey, a.URL, a.FinalURL, a.Title, a.Author, a.PublishedAt,
+		a.Description, a.SiteName, a.Image, a.Content, a.WordCount, string(meta))
+	if err != nil {
+		return fmt.Errorf("failed to insert article: %w", err)
+	}
+	return nil
+}
+
+// saveArticleError records a failed fetch so the link isn't retried every run
+func saveArticleError(db *sql.DB, urlKey, url string, fetchErr error) error {
+	_, err := db.Exec(`INSERT INTO articles (url_key, url, error, fetched_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(url_key) DO UPDATE SET error = excluded.error, fetched_at = excluded.fetched_at`,
+		urlKey, url, fetchErr.Error())
+	if err != nil {
+		return fmt.Errorf("failed to insert article: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+)
+
+const articlePage = `<html><head>
+<meta property="og:title" content="Why SQLite is enough">
+</head><body>
+<nav><a href="/">Home</a></nav>
+<article>
+  <p>SQLite runs in-process and needs no server, which keeps deployments simple.</p>
+</article>
+</body></html>`
+
+func TestProcessURLsSavesArticles(t *testing.T) {
+	blog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, articlePage)
+	}))
+	defer blog.Close()
+	// A different hostname than the listing, so the links count as outbound
+	blogURL := strings.Replace(blog.URL, "127.0.0.1", "localhost", 1)
+
+	listing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<span class="titleline"><a href="%s/post/1">Post 1</a></span>`, blogURL)
+		fmt.Fprintf(w, `<span class="titleline"><a href="%s/post/2">Post 2</a></span>`, blogURL)
+		fmt.Fprint(w, `<span class="titleline"><a href="/item?id=3">Comments</a></span>`)
+	}))
+	defer listing.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(listing.URL, titleLinks)
+	config.Articles = true
+	config.ArticleConcurrency = 2
+
+	summary, err := ProcessURLs(context.Background(), []string{listing.URL + "/"}, db, http.DefaultClient, config, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.ArticlesSaved != 2 {
+		t.Errorf("saved %d articles, want 2", summary.ArticlesSaved)
+	}
+	// Every article belongs to a saved title
+	n := countRows(t, db, `SELECT COUNT(*) FROM articles a JOIN titles t ON t.url_key = a.url_key
+		WHERE a.title = 'Why SQLite is enough' AND a.word_count = 11`)
+	if n != 2 {
+		t.Errorf("%d articles joined to titles, want 2", n)
+	}
+}
+
+func TestArticleEnqueueDropsWhenFull(t *testing.T) {
+	config := newTestConfig("http://listing.example", titleLinks)
+	s := newArticleStage(newTestDB(t), http.DefaultClient, config, discardLogger)
+	s.jobs = make(chan extract.Item, 1)
+
+	// No workers are running, so only the first link fits
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Enqueue([]extract.Item{
+			{URL: "https://blog.example/1"},
+			{URL: "https://blog.example/2"},
+			{URL: "https://blog.example/3"},
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Enqueue blocked on a full queue")
+	}
+
+	// A dropped link can be queued again once there is room
+	<-s.jobs
+	s.Enqueue([]extract.Item{{URL: "https://blog.example/2"}})
+	if item := <-s.jobs; item.URL != "https://blog.example/2" {
+		t.Errorf("queued %s, want the dropped link", item.URL)
+	}
+
+	if saved, dropped := s.Close(); saved != 0 || dropped != 2 {
+		t.Errorf("Close() = %d, %d; want 0 saved and 2 dropped", saved, dropped)
+	}
+}
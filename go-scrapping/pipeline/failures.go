@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+// scrapeError records a URL that could not be scraped after all retries
+type scrapeError struct {
+	URL      string
+	WorkerID int
+	Attempts int
+	Status   int           // last HTTP status, 0 if no response was received
+	Duration time.Duration // time spent on the page, including retries
+	Err      error
+}
+
+func (e *scrapeError) Error() string {
+	return fmt.Sprintf("worker %d failed to scrape %s after %d attempt(s): %v", e.WorkerID, e.URL, e.Attempts, e.Err)
+}
+
+func (e *scrapeError) Unwrap() error {
+	return e.Err
+}
+
+// LogAttrs returns the failure as the structured fields used for page logs
+func (e *scrapeError) LogAttrs() []slog.Attr {
+	return []slog.Attr{
+		slog.Int(logKeyWorkerID, e.WorkerID),
+		slog.String(logKeyURL, e.URL),
+		slog.Int(logKeyStatus, e.Status),
+		durationAttr(e.Duration),
+		slog.Int(logKeyItemCount, 0),
+		slog.Int("attempts", e.Attempts),
+		slog.String("error", e.Err.Error()),
+	}
+}
+
+// Record a permanently failed URL so it can be re-run with -retry-failed
+func recordFailedURL(db *sql.DB, failure *scrapeError) error {
+	statusCode := 0
+	var se *fetch.StatusError
+	if errors.As(failure.Err, &se) {
+		statusCode = se.StatusCode
+	}
+
+	_, err := db.Exec(`INSERT INTO failed_urls (url, error, status_code, attempts, failed_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(url) DO UPDATE SET
+			error = excluded.error,
+			status_code = excluded.status_code,
+			attempts = failed_urls.attempts + excluded.attempts,
+			failed_at = excluded.failed_at`,
+		failure.URL, failure.Err.Error(), statusCode, failure.Attempts)
+	if err != nil {
+		return fmt.Errorf("failed to record failed URL: %w", err)
+	}
+	return nil
+}
+
+// FailedURLs loads the recorded failures. Each stays recorded until a run
+// scrapes it, so URLs that a -retry-failed run never reached aren't lost.
+func FailedURLs(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT url FROM failed_urls ORDER BY failed_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load failed URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// failureLog clears recorded failures once their URL is scraped. A nil
+// *failureLog clears nothing.
+type failureLog struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// Scraped removes url from the recorded failures
+func (f *failureLog) Scraped(url string) {
+	if f == nil {
+		return
+	}
+	if _, err := f.db.Exec("DELETE FROM failed_urls WHERE url = ?", url); err != nil {
+		f.logger.Error("Failed to clear failed URL", logKeyURL, url, "error", err)
+	}
+}
@@ -0,0 +1,234 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+// hnFixtures holds recorded HN pages and the items extracted from each, see
+// the golden test in the extract package
+const hnFixtures = "../testdata/hn"
+
+// serveFixtures serves each recorded page at its original path and query
+func serveFixtures(t *testing.T, fixtures *fetch.Fixtures) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(fixtureHandler(t, fixtures))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func fixtureHandler(t *testing.T, fixtures *fetch.Fixtures) http.Handler {
+	t.Helper()
+	byRequestURI := make(map[string]string)
+	for name, pageURL := range fixtures.Pages() {
+		u, err := url.Parse(pageURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byRequestURI[u.RequestURI()] = filepath.Join(fixtures.Dir, name)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := byRequestURI[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeFile(w, r, path)
+	})
+}
+
+// goldenItems reads the items expected from the recorded pages, with links
+// back to the recorded host pointed at the test server
+func goldenItems(t *testing.T, fixtures *fetch.Fixtures, serverURL string) []extract.Item {
+	t.Helper()
+	var items []extract.Item
+	for name, pageURL := range fixtures.Pages() {
+		data, err := os.ReadFile(filepath.Join(fixtures.Dir, strings.TrimSuffix(name, ".html")+".golden.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page []extract.Item
+		if err := json.Unmarshal(data, &page); err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := url.Parse(pageURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		origin := u.Scheme + "://" + u.Host
+		for _, item := range page {
+			if rest, ok := strings.CutPrefix(item.URL, origin); ok {
+				item.URL = serverURL + rest
+			}
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Rank < items[j].Rank })
+	return items
+}
+
+// TestProcessURLsRecordedHackerNews runs the whole pipeline against the
+// recorded HN pages and checks the titles and rank snapshots it stores
+func TestProcessURLsRecordedHackerNews(t *testing.T) {
+	fixtures, err := fetch.LoadFixtures(hnFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := serveFixtures(t, fixtures)
+
+	var urls []string
+	for _, pageURL := range fixtures.URLs() {
+		u, _ := url.Parse(pageURL)
+		urls = append(urls, srv.URL+u.RequestURI())
+	}
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, extract.HackerNewsSelectors)
+	config.Concurrency = 2
+	config.RunID, err = StartRun(db, []string{"hackernews"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := ProcessURLs(context.Background(), urls, db, srv.Client(), config, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := goldenItems(t, fixtures, srv.URL)
+	if summary.ItemsSaved != len(want) {
+		t.Errorf("summary has %d items, want %d", summary.ItemsSaved, len(want))
+	}
+	if report := summary.Report; report.Succeeded != len(urls) || report.Items != len(want) || report.Bytes == 0 {
+		t.Errorf("report = %+v, want %d pages and %d items", report, len(urls), len(want))
+	}
+
+	rows, err := db.Query(`SELECT item_id, title, url, rank, points, comments
+		FROM snapshots WHERE run_id = ? ORDER BY rank`, config.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []extract.Item
+	for rows.Next() {
+		var item extract.Item
+		if err := rows.Scan(&item.ItemID, &item.Title, &item.URL, &item.Rank, &item.Points, &item.Comments); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, item)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range want {
+		want[i].Site = ""
+		want[i].Fields = nil
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshots differ from the golden items\ngot:  %+v\nwant: %+v", got, want)
+	}
+
+	for _, item := range want {
+		if n := countRows(t, db, "SELECT COUNT(*) FROM titles WHERE title = ? AND url = ?", item.Title, item.URL); n != 1 {
+			t.Errorf("titles has %d rows for %q, want 1", n, item.Title)
+		}
+	}
+}
+
+// crawlFixtures crawls the recorded front page and returns the requests the
+// test server received, counted by request URI
+func crawlFixtures(t *testing.T, configure func(*Config)) (map[string]int, *sql.DB) {
+	t.Helper()
+	fixtures, err := fetch.LoadFixtures(hnFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	handler := fixtureHandler(t, fixtures)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.RequestURI()]++
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, extract.HackerNewsSelectors)
+	config.Concurrency = 4
+	config.Crawl = true
+	configure(&config)
+	if _, err := ProcessURLs(context.Background(), []string{srv.URL + "/"}, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+	return requests, db
+}
+
+func TestCrawlRecordedHackerNews(t *testing.T) {
+	requests, db := crawlFixtures(t, func(c *Config) { c.MaxDepth = 1 })
+
+	// The front page's same-host links are followed once each, including
+	// the ones that resolve back to the front page itself
+	for uri, n := range requests {
+		if n != 1 {
+			t.Errorf("%s requested %d times, want 1", uri, n)
+		}
+	}
+	if requests["/"] != 1 || requests["/news?p=2"] != 1 {
+		t.Errorf("requests = %v, want the front page and page 2", requests)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM crawl_queue WHERE depth = 1"); n != len(requests)-1 {
+		t.Errorf("%d links queued at depth 1, want %d", n, len(requests)-1)
+	}
+
+	// Page 2 is at the depth limit, so its link to page 3 isn't followed
+	if requests["/news?p=3"] != 0 {
+		t.Error("followed a link past the depth limit")
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM crawl_queue WHERE depth > 1"); n != 0 {
+		t.Errorf("%d links queued past the depth limit", n)
+	}
+
+	// Links to other hosts are never crawled
+	if n := countRows(t, db, "SELECT COUNT(*) FROM crawl_queue WHERE url NOT LIKE 'http://127.0.0.1:%'"); n != 0 {
+		t.Errorf("%d links to other hosts queued", n)
+	}
+}
+
+func TestCrawlRecordedHackerNewsMaxPages(t *testing.T) {
+	requests, db := crawlFixtures(t, func(c *Config) {
+		c.MaxDepth = 2
+		c.MaxPages = 5
+	})
+
+	total := 0
+	for _, n := range requests {
+		total += n
+	}
+	if total != 5 {
+		t.Errorf("made %d requests, want the 5 page limit: %v", total, requests)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM crawl_queue"); n != 5 {
+		t.Errorf("%d URLs queued, want 5", n)
+	}
+}
@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+// crawlJob is one URL to scrape and how many links away from a seed it is
+type crawlJob struct {
+	URL   string
+	Depth int
+}
+
+// frontier is an unbounded job queue with a visited set. Workers take jobs
+// from Jobs() and call Done() once a job, including pushing any links it
+// discovered, is finished. The jobs channel closes when the queue is empty
+// and no job is in flight, or when the context is canceled. When a store is
+// set, every queued URL and state change is persisted.
+type frontier struct {
+	maxDepth int // links deeper than this are dropped
+	maxPages int // total URLs accepted, 0 = unlimited
+	store    *queueStore
+
+	mu       sync.Mutex
+	queue    []crawlJob
+	visited  map[string]bool
+	accepted int
+	inFlight int
+
+	out  chan crawlJob
+	wake chan struct{}
+}
+
+func newFrontier(maxDepth, maxPages int, store *queueStore) *frontier {
+	return &frontier{
+		maxDepth: maxDepth,
+		maxPages: maxPages,
+		store:    store,
+		visited:  make(map[string]bool),
+		out:      make(chan crawlJob),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Push queues a URL unless it was seen before or exceeds the depth or page
+// limits. It reports whether the URL was accepted.
+func (f *frontier) Push(rawURL string, depth int) bool {
+	if depth > f.maxDepth {
+		return false
+	}
+	key := store.NormalizeURL(rawURL)
+
+	f.mu.Lock()
+	if f.visited[key] || (f.maxPages > 0 && f.accepted >= f.maxPages) {
+		f.mu.Unlock()
+		return false
+	}
+	f.visited[key] = true
+	f.accepted++
+	job := crawlJob{URL: rawURL, Depth: depth}
+	// Persist before the job becomes visible to Run, so a worker can't
+	// finish it before its row exists
+	if f.store != nil {
+		f.store.Add(job)
+	}
+	f.queue = append(f.queue, job)
+	f.mu.Unlock()
+
+	f.signal()
+	return true
+}
+
+// Restore loads the state of an interrupted run: seen URLs are marked visited
+// and count towards maxPages, pending jobs are queued again
+func (f *frontier) Restore(pending []crawlJob, seen []string) {
+	f.mu.Lock()
+	for _, key := range seen {
+		if !f.visited[key] {
+			f.visited[key] = true
+			f.accepted++
+		}
+	}
+	f.queue = append(f.queue, pending...)
+	f.mu.Unlock()
+	f.signal()
+}
+
+// Done marks a job taken from Jobs() as finished with the given state.
+// jobPending puts it back in line for a resumed run.
+func (f *frontier) Done(job crawlJob, status string) {
+	if f.store != nil {
+		f.store.SetStatus(job.URL, status)
+	}
+
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+	f.signal()
+}
+
+// Jobs returns the channel workers read jobs from
+func (f *frontier) Jobs() <-chan crawlJob {
+	return f.out
+}
+
+// Len returns the number of queued jobs not yet handed to a worker
+func (f *frontier) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.queue)
+}
+
+func (f *frontier) signal() {
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run feeds queued jobs to workers until the crawl is exhausted or ctx is
+// canceled, then closes the jobs channel
+func (f *frontier) Run(ctx context.Context) {
+	defer close(f.out)
+
+	for {
+		f.mu.Lock()
+		if len(f.queue) == 0 && f.inFlight == 0 {
+			f.mu.Unlock()
+			return
+		}
+		var next crawlJob
+		hasNext := len(f.queue) > 0
+		if hasNext {
+			next = f.queue[0]
+		}
+		f.mu.Unlock()
+
+		if !hasNext {
+			// Wait for in-flight jobs to push links or finish
+			select {
+			case <-f.wake:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		select {
+		case f.out <- next:
+			f.mu.Lock()
+			f.queue = f.queue[1:]
+			f.inFlight++
+			f.mu.Unlock()
+			if f.store != nil {
+				f.store.MarkInFlight(next.URL)
+			}
+		case <-f.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+)
+
+// drain takes every job from f, pushing the links returned by links for each
+// one a hop deeper, and returns the URLs in the order they were handed out
+func drain(f *frontier, links func(crawlJob) []string) []string {
+	go f.Run(context.Background())
+	var got []string
+	for job := range f.Jobs() {
+		got = append(got, job.URL)
+		for _, link := range links(job) {
+			f.Push(link, job.Depth+1)
+		}
+		f.Done(job, jobDone)
+	}
+	return got
+}
+
+func TestFrontierDepthLimitAndDedup(t *testing.T) {
+	// Every page links to the seed and to one page a level deeper
+	links := map[string][]string{
+		"https://example.com/":  {"https://example.com/", "https://example.com/1"},
+		"https://example.com/1": {"https://example.com/#top", "https://example.com/2"},
+		"https://example.com/2": {"https://example.com/1/", "https://example.com/3"},
+	}
+	f := newFrontier(2, 0, nil)
+	f.Push("https://example.com/", 0)
+	if f.Push("https://EXAMPLE.com", 0) {
+		t.Error("accepted a seed that normalizes to one already queued")
+	}
+
+	got := drain(f, func(job crawlJob) []string { return links[job.URL] })
+	want := []string{"https://example.com/", "https://example.com/1", "https://example.com/2"}
+	if len(got) != len(want) {
+		t.Fatalf("crawled %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("job %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFrontierMaxPages(t *testing.T) {
+	f := newFrontier(1, 3, nil)
+	f.Push("https://example.com/", 0)
+
+	// Links past the page limit are dropped, seeds included
+	got := drain(f, func(job crawlJob) []string {
+		return []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+	})
+	if len(got) != 3 {
+		t.Errorf("crawled %v, want 3 pages", got)
+	}
+	if f.Push("https://example.com/d", 0) {
+		t.Error("accepted a seed past the page limit")
+	}
+}
+
+func TestFrontierRestoreCountsSeenPages(t *testing.T) {
+	f := newFrontier(0, 2, nil)
+	f.Restore([]crawlJob{{URL: "https://example.com/b"}}, []string{
+		"https://example.com/a",
+		"https://example.com/b",
+	})
+
+	// Pages handled before the interruption aren't queued again and count
+	// towards the limit
+	if f.Push("https://example.com/a", 0) || f.Push("https://example.com/c", 0) {
+		t.Error("accepted a seed after restoring a full frontier")
+	}
+	got := drain(f, func(crawlJob) []string { return nil })
+	if len(got) != 1 || got[0] != "https://example.com/b" {
+		t.Errorf("crawled %v, want only the pending page", got)
+	}
+}
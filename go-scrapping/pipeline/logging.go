@@ -0,0 +1,22 @@
+package pipeline
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Attribute keys shared by every log line about a page, so logs can be
+// filtered by url or worker regardless of which stage wrote them
+const (
+	logKeyWorkerID  = "worker_id"
+	logKeyURL       = "url"
+	logKeyStatus    = "status"
+	logKeyDuration  = "duration"
+	logKeyItemCount = "item_count"
+)
+
+// durationAttr logs a duration in milliseconds, which aggregators can sum
+// and compare unlike Go's duration strings
+func durationAttr(d time.Duration) slog.Attr {
+	return slog.Float64(logKeyDuration, float64(d.Microseconds())/1000)
+}
@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// otherHost is the host label of requests to hosts no site is configured for,
+// such as the article pages linked from a site. Labeling them by name would
+// create a series for every host ever linked.
+const otherHost = "other"
+
+// Metrics holds the Prometheus series exported on -metrics-addr. A nil
+// *Metrics is valid and records nothing, so callers don't need to
+// check whether metrics are enabled.
+type Metrics struct {
+	registry *prometheus.Registry
+	hosts    map[string]bool // hosts labeled by name, see otherHost
+
+	requests       *prometheus.CounterVec
+	fetchDuration  *prometheus.HistogramVec
+	itemsExtracted *prometheus.CounterVec
+	insertDuration prometheus.Histogram
+	queueDepth     *queueDepths
+	activeWorkers  prometheus.Gauge
+}
+
+// NewMetrics returns metrics that label requests and items by host for the
+// given site hosts and as "other" for the rest
+func NewMetrics(hosts []string) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		hosts:    make(map[string]bool, len(hosts)),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scraper_http_requests_total",
+			Help: "HTTP requests sent, by host and status code (\"error\" for transport errors).",
+		}, []string{"host", "code"}),
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scraper_fetch_duration_seconds",
+			Help:    "Time until response headers were received, by host.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"host"}),
+		itemsExtracted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scraper_items_extracted_total",
+			Help: "Items extracted from scraped pages, by host.",
+		}, []string{"host"}),
+		insertDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "scraper_db_insert_duration_seconds",
+			Help:    "Time to write one batch of items to the outputs.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+		}),
+		queueDepth: &queueDepths{
+			desc: prometheus.NewDesc("scraper_queue_depth",
+				"Entries waiting in the jobs and results queues.", []string{"queue"}, nil),
+			queues: map[string]func() int{"jobs": nil, "results": nil},
+		},
+		activeWorkers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "scraper_active_workers",
+			Help: "Workers currently processing a page.",
+		}),
+	}
+	for _, host := range hosts {
+		m.hosts[strings.ToLower(host)] = true
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.fetchDuration,
+		m.itemsExtracted,
+		m.insertDuration,
+		m.queueDepth,
+		m.activeWorkers,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) ObserveRequest(host string, code int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	label := "error"
+	if code != 0 {
+		label = strconv.Itoa(code)
+	}
+	host = m.hostLabel(host)
+	m.requests.WithLabelValues(host, label).Inc()
+	m.fetchDuration.WithLabelValues(host).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) AddItems(host string, n int) {
+	if m == nil {
+		return
+	}
+	m.itemsExtracted.WithLabelValues(m.hostLabel(host)).Add(float64(n))
+}
+
+func (m *Metrics) ObserveInsert(elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.insertDuration.Observe(elapsed.Seconds())
+}
+
+// TrackQueue reports the value of depth as the queue's depth whenever the
+// metrics are scraped, until the returned func is called
+func (m *Metrics) TrackQueue(queue string, depth func() int) (untrack func()) {
+	if m == nil {
+		return func() {}
+	}
+	m.queueDepth.set(queue, depth)
+	return func() { m.queueDepth.set(queue, nil) }
+}
+
+func (m *Metrics) WorkerBusy(busy bool) {
+	if m == nil {
+		return
+	}
+	if busy {
+		m.activeWorkers.Inc()
+	} else {
+		m.activeWorkers.Dec()
+	}
+}
+
+// hostLabel returns the host label for a request or page host, which may
+// include a port
+func (m *Metrics) hostLabel(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if m.hosts[host] {
+		return host
+	}
+	return otherHost
+}
+
+// hostOf returns the host of a URL, matching req.URL.Host
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// queueDepths collects the depth of each queue when the metrics are scraped,
+// so the values are never stale. Untracked queues report 0.
+type queueDepths struct {
+	desc *prometheus.Desc
+
+	mu     sync.Mutex
+	queues map[string]func() int
+}
+
+func (q *queueDepths) set(queue string, depth func() int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queues[queue] = depth
+}
+
+func (q *queueDepths) Describe(ch chan<- *prometheus.Desc) {
+	ch <- q.desc
+}
+
+func (q *queueDepths) Collect(ch chan<- prometheus.Metric) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for queue, depth := range q.queues {
+		n := 0
+		if depth != nil {
+			n = depth()
+		}
+		ch <- prometheus.MustNewConstMetric(q.desc, prometheus.GaugeValue, float64(n), queue)
+	}
+}
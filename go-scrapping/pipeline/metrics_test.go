@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+func TestMetricsRecordLocalScrape(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		storyPage(w, r.URL.Path, 4)
+	}))
+	defer site.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(site.URL, titleLinks)
+	config.Concurrency = 2
+	u, _ := url.Parse(site.URL)
+	config.Metrics = NewMetrics([]string{u.Hostname()})
+	client := site.Client()
+	client.Transport = &fetch.MetricsTransport{Base: client.Transport, Metrics: config.Metrics}
+
+	urls := []string{site.URL + "/a", site.URL + "/b", site.URL + "/missing"}
+	if _, err := ProcessURLs(context.Background(), urls, db, client, config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hosts no site is configured for share one label
+	for _, host := range []string{"a.example:8080", "B.example"} {
+		config.Metrics.ObserveRequest(host, http.StatusOK, time.Millisecond)
+	}
+
+	metricsSrv := httptest.NewServer(config.Metrics.Handler())
+	defer metricsSrv.Close()
+	resp, err := http.Get(metricsSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(body)
+
+	host := u.Hostname()
+	for _, want := range []string{
+		fmt.Sprintf(`scraper_http_requests_total{code="200",host=%q} 2`, host),
+		fmt.Sprintf(`scraper_http_requests_total{code="404",host=%q} 1`, host),
+		fmt.Sprintf(`scraper_fetch_duration_seconds_count{host=%q} 3`, host),
+		fmt.Sprintf(`scraper_items_extracted_total{host=%q} 8`, host),
+		`scraper_http_requests_total{code="200",host="other"} 2`,
+		`scraper_db_insert_duration_seconds_count`,
+		`scraper_queue_depth{queue="jobs"} 0`,
+		`scraper_queue_depth{queue="results"} 0`,
+		`scraper_active_workers 0`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics output is missing %q", want)
+		}
+	}
+}
+
+// scrapeMetrics returns the metrics in the Prometheus text format
+func scrapeMetrics(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestMetricsReadQueueDepthOnScrape(t *testing.T) {
+	m := NewMetrics(nil)
+	depth := 3
+	untrack := m.TrackQueue("jobs", func() int { return depth })
+
+	if text := scrapeMetrics(t, m); !strings.Contains(text, `scraper_queue_depth{queue="jobs"} 3`) {
+		t.Errorf("queue depth not reported:\n%s", text)
+	}
+	depth = 7
+	if text := scrapeMetrics(t, m); !strings.Contains(text, `scraper_queue_depth{queue="jobs"} 7`) {
+		t.Errorf("queue depth not read again on scrape:\n%s", text)
+	}
+
+	// A finished run's queue is empty rather than stuck at its last value
+	untrack()
+	if text := scrapeMetrics(t, m); !strings.Contains(text, `scraper_queue_depth{queue="jobs"} 0`) {
+		t.Errorf("untracked queue not reported as empty:\n%s", text)
+	}
+}
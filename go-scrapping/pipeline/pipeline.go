@@ -0,0 +1,517 @@
+// Package pipeline runs scrapes: a frontier of URLs feeds a pool of workers
+// that fetch and extract pages, and a writer batches the items into the
+// output sinks
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+	"github.com/NoxturneDev/hn-scrapper/store"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Config holds the settings of a scrape run
+type Config struct {
+	Concurrency int
+
+	// Fetch configures the default HTTP fetcher and the article stage
+	Fetch fetch.Options
+
+	// Crawl mode follows same-host links up to MaxDepth hops from the seeds.
+	// MaxPages caps the URLs scraped in any mode (0 = unlimited).
+	Crawl    bool
+	MaxDepth int
+	MaxPages int
+
+	// Resume continues the queue persisted by an interrupted run
+	Resume bool
+
+	// Outputs lists the sink specs, defaulting to SQLite. Items are written
+	// in batches of BatchSize, or whatever arrived within FlushInterval,
+	// each batch in one transaction.
+	Outputs       []string
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// ShutdownTimeout bounds how long in-flight pages may keep running after
+	// ctx is canceled
+	ShutdownTimeout time.Duration
+
+	// Articles follows each item's outbound link and stores its readable
+	// content, using up to ArticleConcurrency extra workers
+	Articles           bool
+	ArticleConcurrency int
+
+	// RunID is the runs table row of the current run, used to tag rank
+	// snapshots. Zero outside of a recorded run.
+	RunID int64
+
+	// Extractors picks the extractor for each page by host. Fetchers holds
+	// the hosts that don't use the default HTTP fetcher.
+	Extractors *extract.Registry
+	Fetchers   *fetch.Registry
+
+	// Robots is nil when robots.txt is ignored
+	Robots *fetch.RobotsCache
+
+	// Metrics is nil unless metrics are exported
+	Metrics *Metrics
+
+	// Alerts is nil unless there is a watchlist
+	Alerts *Alerter
+
+	// stats collects the run report and failures clears the failed_urls
+	// rows of scraped pages, both set by ProcessURLs
+	stats    *runStats
+	failures *failureLog
+}
+
+// ProcessURLs scrapes urls with a pool of workers, writing the items to the
+// configured outputs. In crawl mode links found on the way are followed too.
+func ProcessURLs(ctx context.Context, urls []string, db *sql.DB, client *http.Client, config Config, logger *slog.Logger) (RunSummary, error) {
+	var summary RunSummary
+	config.stats = newRunStats()
+	config.failures = &failureLog{db: db, logger: logger}
+	totalURLs := len(urls)
+	logger.Info("Starting to process URLs", "url_count", totalURLs, "workers", config.Concurrency)
+
+	// Open the configured output sinks once for reuse
+	sink, err := store.OpenSinks(config.Outputs, db, config.RunID)
+	if err != nil {
+		return summary, fmt.Errorf("failed to open outputs: %w", err)
+	}
+	if config.Alerts != nil {
+		sink = alertingSink{Sink: sink, alerts: newAlertSink(db, config.Alerts, logger)}
+	}
+	defer func() {
+		if err := sink.Close(); err != nil {
+			logger.Error("Failed to close outputs", "error", err)
+		}
+	}()
+
+	// Outside crawl mode no links are discovered, so the run ends once the
+	// seeds are done
+	maxDepth := 0
+	if config.Crawl {
+		maxDepth = config.MaxDepth
+	}
+
+	// Seed the frontier, persisting it so the run can be resumed. Seeds that
+	// a resumed run already handled are skipped by the visited set.
+	queue := newQueueStore(db, logger)
+	jobs := newFrontier(maxDepth, config.MaxPages, queue)
+	if config.Resume {
+		pending, seen, err := queue.Load()
+		if err != nil {
+			return summary, err
+		}
+		logger.Info("Resuming previous run", "pending", len(pending), "known", len(seen))
+		jobs.Restore(pending, seen)
+	} else if err := queue.Reset(); err != nil {
+		return summary, err
+	}
+	for _, url := range urls {
+		jobs.Push(url, 0)
+	}
+
+	// ctx only stops new jobs from being handed out. Pages already in flight
+	// keep fetching on fetchCtx until they finish or the shutdown deadline
+	// passes, so their items can still be saved.
+	fetchCtx, cancelFetch := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelFetch()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-fetchCtx.Done():
+			return
+		}
+		logger.Info("Waiting for in-flight pages to finish", "timeout", config.ShutdownTimeout.String())
+		timer := time.NewTimer(config.ShutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			logger.Warn("Shutdown deadline reached, aborting in-flight pages")
+			cancelFetch()
+		case <-fetchCtx.Done():
+		}
+	}()
+
+	results := make(chan extract.Item, totalURLs*30) // Each page might have multiple items
+	errors := make(chan error, totalURLs)
+	defer config.Metrics.TrackQueue("jobs", jobs.Len)()
+	defer config.Metrics.TrackQueue("results", func() int { return len(results) })()
+
+	// Create a new WaitGroup for workers
+	var wg sync.WaitGroup
+
+	// Start the worker pool
+	for i := 0; i < config.Concurrency; i++ {
+		wg.Add(1)
+		go func(workerId int) {
+			defer wg.Done()
+			worker(ctx, fetchCtx, workerId, jobs, results, errors, client, config, logger)
+		}(i)
+	}
+
+	// Article workers follow the links of saved items
+	var articles *articleStage
+	if config.Articles {
+		articles = newArticleStage(db, client, config, logger)
+		articles.Start(ctx, fetchCtx, max(config.ArticleConcurrency, 1))
+	}
+
+	// Database writer goroutine. It drains results until the channel is
+	// closed, so nothing scraped is dropped on shutdown.
+	var dbWg sync.WaitGroup
+	dbWg.Add(1)
+	go func() {
+		defer dbWg.Done()
+		summary.ItemsSaved = processResults(results, sink, articles, config, logger)
+	}()
+
+	// Error handler goroutine
+	var errWg sync.WaitGroup
+	errWg.Add(1)
+	go func() {
+		defer errWg.Done()
+		for err := range errors {
+			summary.Errors++
+			logScrapeError(logger, err)
+			recordFailure(db, err, logger)
+		}
+	}()
+
+	// Hand out jobs until the frontier is exhausted or ctx is canceled
+	go jobs.Run(ctx)
+
+	// Wait for all workers to complete
+	wg.Wait()
+	close(results)
+	close(errors)
+
+	// Wait for the DB writer to finish, then for the articles it queued
+	dbWg.Wait()
+	errWg.Wait()
+	if articles != nil {
+		var dropped int
+		summary.ArticlesSaved, dropped = articles.Close()
+		logger.Info("Articles saved", "count", summary.ArticlesSaved)
+		if dropped > 0 {
+			logger.Warn("Article queue was full, left articles for the next run", "count", dropped)
+		}
+	}
+
+	counts, err := queue.Counts()
+	if err != nil {
+		return summary, err
+	}
+	summary.PagesDone = counts[jobDone]
+	summary.PagesFailed = counts[jobFailed]
+	summary.Unfinished = counts[jobPending] + counts[jobInFlight]
+	summary.Report = config.stats.Report(summary.Unfinished)
+	summary.Skipped = summary.Report.Skipped
+	if config.Robots != nil {
+		logger.Info("Skipped URLs disallowed by robots.txt", "count", summary.Skipped)
+	}
+	logger.Info("Run summary",
+		"pages_done", summary.PagesDone,
+		"pages_failed", summary.PagesFailed,
+		"unfinished", summary.Unfinished,
+		logKeyItemCount, summary.ItemsSaved,
+		"attempted", summary.Report.Attempted,
+		"skipped", summary.Report.Skipped,
+		"bytes", summary.Report.Bytes,
+		"latency_p50_ms", summary.Report.LatencyP50,
+		"latency_p95_ms", summary.Report.LatencyP95)
+	for _, domain := range summary.Report.EmptyDomains() {
+		logger.Warn("Pages were scraped but no items extracted, the site's markup may have changed", "domain", domain)
+	}
+	if summary.Unfinished > 0 {
+		logger.Info("URLs left unfinished, run again with -resume to continue", "count", summary.Unfinished)
+	}
+
+	return summary, nil
+}
+
+// Worker processes URLs from the frontier until it is exhausted or stopped
+func worker(ctx, fetchCtx context.Context, id int, jobs *frontier, results chan<- extract.Item, errors chan<- error, client *http.Client, config Config, logger *slog.Logger) {
+	logger = logger.With(logKeyWorkerID, id)
+	for job := range jobs.Jobs() {
+		config.Metrics.WorkerBusy(true)
+		status := processJob(ctx, fetchCtx, id, job, jobs, results, errors, client, config, logger)
+		config.Metrics.WorkerBusy(false)
+		jobs.Done(job, status)
+	}
+}
+
+// Scrape a single job, sending its items to results and, in crawl mode, its
+// same-host links back to the frontier. Jobs not yet started when ctx is
+// canceled are skipped; started ones run on fetchCtx. It returns the job's new
+// state. Jobs left pending or failed are fetched again on resume.
+func processJob(ctx, fetchCtx context.Context, id int, job crawlJob, jobs *frontier, results chan<- extract.Item, errors chan<- error, client *http.Client, config Config, logger *slog.Logger) string {
+	url := job.URL
+	select {
+	case <-ctx.Done():
+		return jobPending
+	default:
+	}
+	logger = logger.With(logKeyURL, url)
+
+	if config.Robots != nil {
+		allowed, err := config.Robots.Allowed(fetchCtx, url)
+		if err != nil {
+			// Not a robots skip: a failure that -resume tries again
+			config.stats.PageFailed(url, 0, err)
+			errors <- &scrapeError{URL: url, WorkerID: id, Err: err}
+			return jobFailed
+		}
+		if !allowed {
+			logger.Info("Skipping URL disallowed by robots.txt")
+			config.stats.PageSkipped(url)
+			return jobDone
+		}
+	}
+
+	logger.Debug("Processing page", "depth", job.Depth)
+	start := time.Now()
+	page, err := scrapeURL(fetchCtx, url, client, config)
+	elapsed := time.Since(start)
+	if err != nil {
+		if fetchCtx.Err() != nil {
+			return jobPending
+		}
+		config.stats.PageFailed(url, elapsed, err)
+		errors <- &scrapeError{
+			URL:      url,
+			WorkerID: id,
+			Attempts: page.Attempts,
+			Status:   page.StatusCode,
+			Duration: elapsed,
+			Err:      err,
+		}
+		return jobFailed
+	}
+	logger.LogAttrs(fetchCtx, slog.LevelInfo, "Scraped page",
+		slog.Int(logKeyStatus, page.StatusCode),
+		durationAttr(elapsed),
+		slog.Int(logKeyItemCount, len(page.Items)),
+		slog.Int("attempts", page.Attempts),
+		slog.Int("depth", job.Depth),
+		slog.Int("link_count", len(page.Links)),
+		slog.Bool("unchanged", page.Unchanged))
+	config.stats.PageDone(url, elapsed, page)
+	config.failures.Scraped(url)
+
+	// Feed discovered links back into the frontier
+	for _, link := range page.Links {
+		jobs.Push(link, job.Depth+1)
+	}
+
+	config.Metrics.AddItems(hostOf(url), len(page.Items))
+
+	// Send all scraped items to results channel. The writer drains it until
+	// it is closed, so this can't block forever.
+	for _, item := range page.Items {
+		results <- item
+	}
+	return jobDone
+}
+
+// defaultFlushInterval replaces a FlushInterval that isn't positive
+const defaultFlushInterval = time.Second
+
+// Process results and write them to the output sinks in batches, flushing
+// when a batch is full or the flush interval elapses. Written items are
+// passed on to the article stage, if any. It returns the number of items
+// saved once results is closed.
+func processResults(results <-chan extract.Item, sink store.Sink, articles *articleStage, config Config, logger *slog.Logger) int {
+	batchSize := max(config.BatchSize, 1)
+	batch := make([]extract.Item, 0, batchSize)
+	count := 0
+	lastReport := 0
+	start := time.Now()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		writeStart := time.Now()
+		err := sink.WriteBatch(batch)
+		elapsed := time.Since(writeStart)
+		config.Metrics.ObserveInsert(elapsed)
+		if err != nil {
+			logger.Error("Failed to write batch", logKeyItemCount, len(batch), durationAttr(elapsed), "error", err)
+		} else {
+			count += len(batch)
+			articles.Enqueue(batch)
+			logger.Debug("Wrote batch", logKeyItemCount, len(batch), durationAttr(elapsed))
+			if count-lastReport >= 100 {
+				lastReport = count
+				logger.Info("Processed items so far", logKeyItemCount, count, "items_per_sec", float64(count)/time.Since(start).Seconds())
+			}
+		}
+		batch = batch[:0]
+	}
+
+	flushInterval := config.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case item, ok := <-results:
+			if !ok {
+				flush()
+				logger.Info("Total items saved", logKeyItemCount, count, "items_per_sec", float64(count)/time.Since(start).Seconds())
+				return count
+			}
+			batch = append(batch, item)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// pageResult is what scraping a single page produced
+type pageResult struct {
+	StatusCode int // final HTTP status, 0 if no response was received
+	Items      []extract.Item
+	Links      []string // same-host links, only collected in crawl mode
+	Attempts   int      // fetch attempts, also set when scraping failed
+	Unchanged  bool     // served from the HTTP cache, only ranked sites are extracted again
+	Bytes      int64    // body bytes read, 0 for unchanged pages
+	Extracted  int      // items the site's extractor found, before the <title> fallback
+}
+
+// Scrape a URL for titles and, in crawl mode, links to follow
+func scrapeURL(ctx context.Context, url string, client *http.Client, config Config) (pageResult, error) {
+	var page pageResult
+
+	pageURL, err := neturl.Parse(url)
+	if err != nil {
+		return page, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	// Pick the extractor configured for this host
+	extractor := config.Extractors.Lookup(pageURL)
+	if extractor == nil {
+		return page, fmt.Errorf("no site config for host %q", pageURL.Host)
+	}
+
+	// Fetch the page with the site's fetcher, retrying transient failures
+	fetcher := config.Fetchers.Lookup(pageURL)
+	if fetcher == nil {
+		fetcher = &fetch.HTTPFetcher{Client: client, Options: config.Fetch}
+	}
+	fetched, err := fetcher.Fetch(ctx, url)
+	page.Attempts = fetched.Attempts
+	if err != nil {
+		var se *fetch.StatusError
+		if errors.As(err, &se) {
+			page.StatusCode = se.StatusCode
+		}
+		return page, err
+	}
+	defer fetched.Body.Close()
+	page.StatusCode = fetched.StatusCode
+
+	// Pages unchanged since the last scrape have nothing new to extract,
+	// except on ranked sites where each run needs a full rank snapshot. In
+	// crawl mode they are still parsed for links so the crawl can go on.
+	unchanged := fetched.Unchanged
+	page.Unchanged = unchanged
+	skipExtract := unchanged && !tracksRank(extractor)
+	if skipExtract && !config.Crawl {
+		return page, nil
+	}
+
+	// Parse the HTML document, counting what was downloaded
+	body := &countingReader{r: fetched.Body}
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return page, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	if !unchanged {
+		page.Bytes = body.n
+	}
+
+	if config.Crawl {
+		page.Links = extract.Links(doc, pageURL)
+	}
+	if skipExtract {
+		return page, nil
+	}
+
+	items := extractor.Extract(doc, pageURL)
+	page.Extracted = len(items)
+
+	if len(items) == 0 {
+		// Fallback to generic title if no stories found
+		title := doc.Find("title").Text()
+		if title != "" {
+			items = append(items, extract.Item{
+				Title: title,
+				URL:   url,
+			})
+		}
+	}
+
+	page.Items = items
+	return page, nil
+}
+
+// Log an error from the errors channel with the page's trace fields
+func logScrapeError(logger *slog.Logger, err error) {
+	var failure *scrapeError
+	if errors.As(err, &failure) {
+		logger.LogAttrs(context.Background(), slog.LevelError, "Failed to scrape page", failure.LogAttrs()...)
+		return
+	}
+	logger.Error("Failed to scrape page", "error", err)
+}
+
+// Record a permanent scrape failure, unless it was caused by shutdown
+func recordFailure(db *sql.DB, err error, logger *slog.Logger) {
+	var failure *scrapeError
+	if !errors.As(err, &failure) || errors.Is(err, context.Canceled) {
+		return
+	}
+	if err := recordFailedURL(db, failure); err != nil {
+		logger.Error("Failed to record failed URL", logKeyURL, failure.URL, "error", err)
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// tracksRank reports whether the extractor captures listing positions
+func tracksRank(extractor extract.Extractor) bool {
+	ranked, ok := extractor.(extract.RankTracker)
+	return ok && ranked.TracksRank()
+}
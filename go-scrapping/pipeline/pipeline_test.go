@@ -0,0 +1,370 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+// newTestDB returns an in-memory database with the scraper's schema
+func newTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	db, err := store.Open(store.MemoryPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	if err := store.Migrate(db); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestConfig returns a config that scrapes items matching selectors from
+// the given test server, with retries and robots.txt checks disabled
+func newTestConfig(serverURL string, selectors extract.Selectors) Config {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		panic(err)
+	}
+	config := Config{
+		Concurrency:     1,
+		Fetch:           fetch.Options{UserAgent: "GoScraperTest/1.0"},
+		BatchSize:       10,
+		FlushInterval:   50 * time.Millisecond,
+		ShutdownTimeout: time.Second,
+		Extractors:      extract.NewRegistry(),
+	}
+	config.Extractors.Register(u.Hostname(), extract.NewSelectorExtractor("test", selectors))
+	return config
+}
+
+// titleLinks matches the story links of storyPage
+var titleLinks = extract.Selectors{Item: ".titleline > a"}
+
+// storyPage renders a page with n stories whose URLs are unique per path
+func storyPage(w http.ResponseWriter, path string, n int) {
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, "<html><body>")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(w, `<span class="titleline"><a href="https://example.com%s/%d">Story %d</a></span>`, path, i, i)
+	}
+	fmt.Fprint(w, "</body></html>")
+}
+
+func countRows(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func queueStatus(t *testing.T, db *sql.DB, url string) string {
+	t.Helper()
+	var status string
+	err := db.QueryRow("SELECT status FROM crawl_queue WHERE url_key = ?", store.NormalizeURL(url)).Scan(&status)
+	if err != nil {
+		t.Fatalf("no queue entry for %s: %v", url, err)
+	}
+	return status
+}
+
+func TestProcessURLsSavesAllItems(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storyPage(w, r.URL.Path, 5)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, titleLinks)
+	config.Concurrency = 3
+	urls := []string{srv.URL + "/a", srv.URL + "/b", srv.URL + "/c"}
+
+	if _, err := ProcessURLs(context.Background(), urls, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countRows(t, db, "SELECT COUNT(*) FROM titles"); n != 15 {
+		t.Errorf("saved %d titles, want 15", n)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM crawl_queue WHERE status = ?", jobDone); n != 3 {
+		t.Errorf("%d URLs done, want 3", n)
+	}
+}
+
+func TestProcessURLsDefaultsBadBatchSettings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storyPage(w, r.URL.Path, 2)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, titleLinks)
+	config.BatchSize = 0
+	config.FlushInterval = 0
+	if _, err := ProcessURLs(context.Background(), []string{srv.URL + "/a"}, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM titles"); n != 2 {
+		t.Errorf("saved %d titles, want 2", n)
+	}
+}
+
+func TestProcessURLsDrainsInFlightPagesOnCancel(t *testing.T) {
+	started := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+		}
+		storyPage(w, r.URL.Path, 3)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, titleLinks)
+	urls := []string{srv.URL + "/slow", srv.URL + "/a", srv.URL + "/b"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	if _, err := ProcessURLs(ctx, urls, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+
+	// The in-flight page finished and its items were flushed
+	if n := countRows(t, db, "SELECT COUNT(*) FROM titles"); n != 3 {
+		t.Errorf("saved %d titles, want 3 from the in-flight page", n)
+	}
+	if got := queueStatus(t, db, srv.URL+"/slow"); got != jobDone {
+		t.Errorf("/slow status = %q, want %q", got, jobDone)
+	}
+
+	// Jobs that hadn't started are left for -resume
+	for _, path := range []string{"/a", "/b"} {
+		if got := queueStatus(t, db, srv.URL+path); got != jobPending {
+			t.Errorf("%s status = %q, want %q", path, got, jobPending)
+		}
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM failed_urls"); n != 0 {
+		t.Errorf("%d URLs recorded as failed, want 0", n)
+	}
+}
+
+func TestResumeFinishesPendingAndFailedURLs(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	var broken atomic.Bool
+	broken.Store(true)
+	started := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/broken" && broken.Load():
+			http.NotFound(w, r)
+			return
+		case r.URL.Path == "/slow" && n == 1:
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+		}
+		storyPage(w, r.URL.Path, 1)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, titleLinks)
+	var urls []string
+	for _, path := range []string{"/done", "/broken", "/slow", "/a", "/b"} {
+		urls = append(urls, srv.URL+path)
+	}
+
+	// Interrupt the run while /slow is being fetched
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := ProcessURLs(ctx, urls, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"/done": jobDone, "/broken": jobFailed, "/slow": jobDone, "/a": jobPending, "/b": jobPending}
+	for path, status := range want {
+		if got := queueStatus(t, db, srv.URL+path); got != status {
+			t.Errorf("%s status after the interrupted run = %q, want %q", path, got, status)
+		}
+	}
+
+	broken.Store(false)
+	config.Resume = true
+	summary, err := ProcessURLs(context.Background(), urls, db, srv.Client(), config, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Unfinished != 0 || summary.PagesFailed != 0 {
+		t.Errorf("summary = %+v, want every URL finished", summary)
+	}
+
+	// Pending and failed URLs were fetched again, finished ones weren't
+	wantRequests := map[string]int{"/done": 1, "/broken": 2, "/slow": 1, "/a": 1, "/b": 1}
+	for path, n := range wantRequests {
+		if requests[path] != n {
+			t.Errorf("%s requested %d times, want %d", path, requests[path], n)
+		}
+		if got := queueStatus(t, db, srv.URL+path); got != jobDone {
+			t.Errorf("%s status after resuming = %q, want %q", path, got, jobDone)
+		}
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM failed_urls"); n != 0 {
+		t.Errorf("%d failed URLs left after resuming", n)
+	}
+}
+
+func TestProcessURLsAbortsAfterShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		// Hang until the client gives up
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, titleLinks)
+	config.ShutdownTimeout = 100 * time.Millisecond
+	hung := srv.URL + "/hung"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	begin := time.Now()
+	if _, err := ProcessURLs(ctx, []string{hung}, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > 2*time.Second {
+		t.Errorf("ProcessURLs took %s to stop, want about the shutdown timeout", elapsed)
+	}
+
+	// The aborted page is neither saved nor treated as a permanent failure
+	if got := queueStatus(t, db, hung); got != jobPending {
+		t.Errorf("status = %q, want %q", got, jobPending)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM failed_urls"); n != 0 {
+		t.Errorf("%d URLs recorded as failed, want 0", n)
+	}
+}
+
+func TestFailedURLsStayRecordedUntilScraped(t *testing.T) {
+	var broken atomic.Bool
+	broken.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky" && broken.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		storyPage(w, r.URL.Path, 1)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, titleLinks)
+	if _, err := ProcessURLs(context.Background(), []string{srv.URL + "/ok", srv.URL + "/flaky"}, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading the failures for a retry doesn't clear them
+	for range 2 {
+		urls, err := FailedURLs(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(urls) != 1 || urls[0] != srv.URL+"/flaky" {
+			t.Fatalf("FailedURLs() = %v, want the flaky page", urls)
+		}
+	}
+
+	broken.Store(false)
+	urls, _ := FailedURLs(db)
+	if _, err := ProcessURLs(context.Background(), urls, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM failed_urls"); n != 0 {
+		t.Errorf("%d failed URLs left after they were scraped", n)
+	}
+}
+
+func TestUnreachableRobotsTxtIsRetriedOnResume(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			if down.Load() {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+			}
+			return
+		}
+		storyPage(w, r.URL.Path, 1)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, titleLinks)
+	config.Robots = fetch.NewRobotsCache(srv.Client(), "GoScraperTest/1.0", fetch.NewHostLimiter(fetch.Politeness{}))
+	page := srv.URL + "/a"
+	if _, err := ProcessURLs(context.Background(), []string{page}, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+
+	// The page is a failure, not a robots skip
+	if n := countRows(t, db, "SELECT COUNT(*) FROM failed_urls WHERE url = ?", page); n != 1 {
+		t.Errorf("page not recorded in failed_urls")
+	}
+	if got := queueStatus(t, db, page); got != jobFailed {
+		t.Errorf("status = %q, want %q", got, jobFailed)
+	}
+
+	down.Store(false)
+	config.Robots = fetch.NewRobotsCache(srv.Client(), "GoScraperTest/1.0", fetch.NewHostLimiter(fetch.Politeness{}))
+	config.Resume = true
+	if _, err := ProcessURLs(context.Background(), nil, db, srv.Client(), config, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+	if got := queueStatus(t, db, page); got != jobDone {
+		t.Errorf("status after resume = %q, want %q", got, jobDone)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM failed_urls"); n != 0 {
+		t.Errorf("%d failed URLs left after the resumed run", n)
+	}
+}
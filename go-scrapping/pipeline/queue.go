@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+// Job states persisted in crawl_queue
+const (
+	jobPending  = "pending"
+	jobInFlight = "in_flight"
+	jobDone     = "done"
+	jobFailed   = "failed"
+)
+
+// queueStore persists the frontier and each URL's state in SQLite so an
+// interrupted run can be continued with -resume
+type queueStore struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func newQueueStore(db *sql.DB, logger *slog.Logger) *queueStore {
+	return &queueStore{db: db, logger: logger}
+}
+
+// Reset forgets the previous run's queue
+func (q *queueStore) Reset() error {
+	if _, err := q.db.Exec("DELETE FROM crawl_queue"); err != nil {
+		return fmt.Errorf("failed to reset crawl queue: %w", err)
+	}
+	return nil
+}
+
+// Load returns the jobs left unfinished by the previous run and the keys of
+// every URL it already handled. Jobs that were in flight when the run stopped
+// or that failed are returned as pending so they are fetched again.
+func (q *queueStore) Load() (pending []crawlJob, seen []string, err error) {
+	rows, err := q.db.Query("SELECT url_key, url, depth, status FROM crawl_queue ORDER BY rowid")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load crawl queue: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, url, status string
+		var depth int
+		if err := rows.Scan(&key, &url, &depth, &status); err != nil {
+			return nil, nil, err
+		}
+		seen = append(seen, key)
+		if status != jobDone {
+			pending = append(pending, crawlJob{URL: url, Depth: depth})
+		}
+	}
+	return pending, seen, rows.Err()
+}
+
+// Add records a newly queued URL
+func (q *queueStore) Add(job crawlJob) {
+	_, err := q.db.Exec(`INSERT INTO crawl_queue (url_key, url, depth, status, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(url_key) DO NOTHING`,
+		store.NormalizeURL(job.URL), job.URL, job.Depth, jobPending)
+	if err != nil {
+		q.logger.Error("Failed to persist queued URL", logKeyURL, job.URL, "error", err)
+	}
+}
+
+// SetStatus updates the state of a queued URL
+func (q *queueStore) SetStatus(url, status string) {
+	_, err := q.db.Exec("UPDATE crawl_queue SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE url_key = ?",
+		status, store.NormalizeURL(url))
+	if err != nil {
+		q.logger.Error("Failed to persist URL status", logKeyURL, url, "error", err)
+	}
+}
+
+// MarkInFlight flags a pending URL as handed to a worker. The status guard
+// keeps it from overwriting a result the worker may already have recorded.
+func (q *queueStore) MarkInFlight(url string) {
+	_, err := q.db.Exec("UPDATE crawl_queue SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE url_key = ? AND status = ?",
+		jobInFlight, store.NormalizeURL(url), jobPending)
+	if err != nil {
+		q.logger.Error("Failed to persist URL status", logKeyURL, url, "error", err)
+	}
+}
+
+// Counts returns the number of URLs in each state
+func (q *queueStore) Counts() (map[string]int, error) {
+	rows, err := q.db.Query("SELECT status, COUNT(*) FROM crawl_queue GROUP BY status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count crawl queue: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,279 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// topErrorCount is how many distinct errors a run report lists
+const topErrorCount = 5
+
+// RunReport is the per-domain outcome of a run. It is logged and saved as
+// JSON in the runs table, so a site whose item count drops to zero after a
+// markup change stands out.
+type RunReport struct {
+	// Attempted counts the URLs a worker picked up: the ones that
+	// succeeded, failed or were skipped by robots.txt. Unfinished URLs were
+	// left pending by an interrupted run.
+	Attempted  int `json:"attempted"`
+	Succeeded  int `json:"succeeded"`
+	Failed     int `json:"failed"`
+	Skipped    int `json:"skipped"`
+	Unfinished int `json:"unfinished"`
+
+	// Items counts what the site extractors found, not the <title>
+	// fallback items saved for pages where they found nothing
+	Items int   `json:"items"`
+	Bytes int64 `json:"bytes"`
+
+	// Page latencies in milliseconds, including retries
+	LatencyP50 float64 `json:"latency_p50_ms"`
+	LatencyP95 float64 `json:"latency_p95_ms"`
+
+	Domains   []DomainReport `json:"domains"`
+	TopErrors []ErrorCount   `json:"top_errors,omitempty"`
+}
+
+// DomainReport is the part of a run report for one host. Items counts what
+// the site's extractor found; unchanged pages aren't extracted again.
+type DomainReport struct {
+	Domain     string  `json:"domain"`
+	Attempted  int     `json:"attempted"`
+	Succeeded  int     `json:"succeeded"`
+	Unchanged  int     `json:"unchanged"`
+	Failed     int     `json:"failed"`
+	Skipped    int     `json:"skipped"`
+	Items      int     `json:"items"`
+	Bytes      int64   `json:"bytes"`
+	LatencyP50 float64 `json:"latency_p50_ms"`
+	LatencyP95 float64 `json:"latency_p95_ms"`
+}
+
+// ErrorCount is one kind of error and how many pages failed with it
+type ErrorCount struct {
+	Error   string `json:"error"`
+	Count   int    `json:"count"`
+	Example string `json:"example_url"`
+}
+
+// runStats collects page outcomes for the run report. A nil *runStats
+// records nothing.
+type runStats struct {
+	mu        sync.Mutex
+	domains   map[string]*domainStats
+	errors    map[string]*ErrorCount
+	latencies []time.Duration
+}
+
+type domainStats struct {
+	report    DomainReport
+	latencies []time.Duration
+}
+
+func newRunStats() *runStats {
+	return &runStats{
+		domains: make(map[string]*domainStats),
+		errors:  make(map[string]*ErrorCount),
+	}
+}
+
+func (s *runStats) domain(pageURL string) *domainStats {
+	host := hostOf(pageURL)
+	d := s.domains[host]
+	if d == nil {
+		d = &domainStats{report: DomainReport{Domain: host}}
+		s.domains[host] = d
+	}
+	return d
+}
+
+// PageDone records a page that was scraped
+func (s *runStats) PageDone(pageURL string, elapsed time.Duration, page pageResult) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.domain(pageURL)
+	d.report.Succeeded++
+	if page.Unchanged {
+		d.report.Unchanged++
+	}
+	d.report.Items += page.Extracted
+	d.report.Bytes += page.Bytes
+	d.latencies = append(d.latencies, elapsed)
+	s.latencies = append(s.latencies, elapsed)
+}
+
+// PageFailed records a page that could not be scraped after all retries
+func (s *runStats) PageFailed(pageURL string, elapsed time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.domain(pageURL)
+	d.report.Failed++
+	if elapsed > 0 {
+		d.latencies = append(d.latencies, elapsed)
+		s.latencies = append(s.latencies, elapsed)
+	}
+
+	key := errorKey(err)
+	e := s.errors[key]
+	if e == nil {
+		e = &ErrorCount{Error: key, Example: pageURL}
+		s.errors[key] = e
+	}
+	e.Count++
+}
+
+// PageSkipped records a page disallowed by robots.txt
+func (s *runStats) PageSkipped(pageURL string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.domain(pageURL).report.Skipped++
+}
+
+// Report summarizes the recorded pages, with domains sorted by name and
+// errors by how often they occurred
+func (s *runStats) Report(unfinished int) RunReport {
+	report := RunReport{Unfinished: unfinished, Domains: []DomainReport{}}
+	if s == nil {
+		return report
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.domains {
+		r := d.report
+		r.Attempted = r.Succeeded + r.Failed + r.Skipped
+		r.LatencyP50 = percentileMillis(d.latencies, 50)
+		r.LatencyP95 = percentileMillis(d.latencies, 95)
+		report.Domains = append(report.Domains, r)
+
+		report.Attempted += r.Attempted
+		report.Succeeded += r.Succeeded
+		report.Failed += r.Failed
+		report.Skipped += r.Skipped
+		report.Items += r.Items
+		report.Bytes += r.Bytes
+	}
+	sort.Slice(report.Domains, func(i, j int) bool { return report.Domains[i].Domain < report.Domains[j].Domain })
+	report.LatencyP50 = percentileMillis(s.latencies, 50)
+	report.LatencyP95 = percentileMillis(s.latencies, 95)
+
+	for _, e := range s.errors {
+		report.TopErrors = append(report.TopErrors, *e)
+	}
+	sort.Slice(report.TopErrors, func(i, j int) bool {
+		a, b := report.TopErrors[i], report.TopErrors[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Error < b.Error
+	})
+	if len(report.TopErrors) > topErrorCount {
+		report.TopErrors = report.TopErrors[:topErrorCount]
+	}
+	return report
+}
+
+// EmptyDomains returns the domains where changed pages were scraped but the
+// extractor found no items, which usually means the site's markup changed
+func (r RunReport) EmptyDomains() []string {
+	var domains []string
+	for _, d := range r.Domains {
+		if d.Succeeded > d.Unchanged && d.Items == 0 {
+			domains = append(domains, d.Domain)
+		}
+	}
+	return domains
+}
+
+// WriteTable prints the report for people
+func (r RunReport) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "Attempted %d URLs: %d succeeded, %d failed, %d skipped, %d unfinished\n",
+		r.Attempted, r.Succeeded, r.Failed, r.Skipped, r.Unfinished)
+	fmt.Fprintf(w, "Extracted %d items from %s, latency p50 %s p95 %s\n\n",
+		r.Items, formatBytes(r.Bytes), formatMillis(r.LatencyP50), formatMillis(r.LatencyP95))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOMAIN\tATTEMPTED\tSUCCEEDED\tFAILED\tSKIPPED\tITEMS\tBYTES\tP50\tP95")
+	for _, d := range r.Domains {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", d.Domain, d.Attempted, d.Succeeded, d.Failed,
+			d.Skipped, d.Items, formatBytes(d.Bytes), formatMillis(d.LatencyP50), formatMillis(d.LatencyP95))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.TopErrors) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "COUNT\tERROR\tEXAMPLE")
+		for _, e := range r.TopErrors {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", e.Count, e.Error, e.Example)
+		}
+		return tw.Flush()
+	}
+	return nil
+}
+
+// errorKey groups failures by cause, leaving out the URL that a transport
+// error repeats
+func errorKey(err error) string {
+	var failure *scrapeError
+	if errors.As(err, &failure) {
+		err = failure.Err
+	}
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return err.Error()
+}
+
+// percentileMillis returns the nearest-rank percentile p of durations in
+// milliseconds, 0 for none
+func percentileMillis(durations []time.Duration, p int) float64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100
+	return float64(sorted[max(rank, 1)-1]) / float64(time.Millisecond)
+}
+
+func formatMillis(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond).String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+func TestRunStatsReport(t *testing.T) {
+	stats := newRunStats()
+	for i := 1; i <= 20; i++ {
+		stats.PageDone("https://a.example/p", time.Duration(i)*time.Millisecond, pageResult{Bytes: 100, Extracted: 3})
+	}
+	stats.PageDone("https://b.example/", 5*time.Millisecond, pageResult{Bytes: 50})
+	stats.PageDone("https://c.example/", time.Millisecond, pageResult{Unchanged: true})
+	stats.PageSkipped("https://b.example/private")
+	stats.PageFailed("https://b.example/x", time.Millisecond, &scrapeError{Err: &fetch.StatusError{StatusCode: 503}})
+	stats.PageFailed("https://b.example/y", time.Millisecond, &scrapeError{Err: &fetch.StatusError{StatusCode: 503}})
+	stats.PageFailed("https://a.example/z", time.Millisecond, context.DeadlineExceeded)
+
+	report := stats.Report(4)
+
+	if report.Attempted != 26 || report.Succeeded != 22 || report.Failed != 3 || report.Skipped != 1 || report.Unfinished != 4 {
+		t.Errorf("counts = %+v", report)
+	}
+	if report.Items != 60 || report.Bytes != 2050 {
+		t.Errorf("items = %d, bytes = %d; want 60 and 2050", report.Items, report.Bytes)
+	}
+
+	a := report.Domains[0]
+	if a.Domain != "a.example" || a.LatencyP50 != 10 || a.LatencyP95 != 19 {
+		t.Errorf("a.example = %+v, want p50 10ms and p95 19ms", a)
+	}
+
+	wantErrors := []ErrorCount{
+		{Error: "received non-200 status code: 503", Count: 2, Example: "https://b.example/x"},
+		{Error: "timeout", Count: 1, Example: "https://a.example/z"},
+	}
+	if !reflect.DeepEqual(report.TopErrors, wantErrors) {
+		t.Errorf("top errors = %+v, want %+v", report.TopErrors, wantErrors)
+	}
+	// c.example only had an unchanged page, which has nothing to extract
+	if got := report.EmptyDomains(); !reflect.DeepEqual(got, []string{"b.example"}) {
+		t.Errorf("empty domains = %v, want b.example", got)
+	}
+}
+
+func TestReportFlagsPagesWhereSelectorsMatchNothing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><head><title>Redesigned front page</title></head>
+<body><div class="story-card"><a href="/s/1">Story</a></div></body></html>`)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, titleLinks)
+	summary, err := ProcessURLs(context.Background(), []string{srv.URL + "/"}, db, srv.Client(), config, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The <title> fallback is still saved, but doesn't count as extracted
+	if summary.ItemsSaved != 1 {
+		t.Errorf("saved %d items, want the <title> fallback", summary.ItemsSaved)
+	}
+	if summary.Report.Items != 0 {
+		t.Errorf("report has %d items, want 0", summary.Report.Items)
+	}
+	if got := summary.Report.EmptyDomains(); !reflect.DeepEqual(got, []string{hostOf(srv.URL)}) {
+		t.Errorf("empty domains = %v, want %s", got, hostOf(srv.URL))
+	}
+}
+
+func TestFinishRunSavesReport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+			return
+		}
+		storyPage(w, r.URL.Path, 4)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	config := newTestConfig(srv.URL, titleLinks)
+	runID, err := StartRun(db, []string{"test"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.RunID = runID
+
+	summary, runErr := ProcessURLs(context.Background(), []string{srv.URL + "/a", srv.URL + "/gone"}, db, srv.Client(), config, discardLogger)
+	if err := FinishRun(db, runID, summary, runErr, false); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := LoadRun(db, runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Report == nil {
+		t.Fatal("no report saved with the run")
+	}
+	if run.Report.Succeeded != 1 || run.Report.Failed != 1 || run.Report.Items != 4 {
+		t.Errorf("saved report = %+v", run.Report)
+	}
+	if len(run.Report.TopErrors) != 1 || run.Report.TopErrors[0].Example != srv.URL+"/gone" {
+		t.Errorf("top errors = %+v", run.Report.TopErrors)
+	}
+
+	// The saved JSON is the same report ProcessURLs returned
+	want, _ := json.Marshal(summary.Report)
+	got, _ := json.Marshal(run.Report)
+	if string(got) != string(want) {
+		t.Errorf("saved report differs:\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestListRunsMatchesSiteNamesExactly(t *testing.T) {
+	db := newTestDB(t)
+	for _, sites := range [][]string{{"hn_jobs"}, {"hnxjobs", "lobsters"}, {"100%"}, {"1000"}} {
+		if _, err := StartRun(db, sites, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Wildcards in a site name only match themselves
+	for site, want := range map[string]int{"hn_jobs": 1, "lobsters": 1, "100%": 1, "%": 0, "": 4} {
+		runs, err := ListRuns(db, site, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != want {
+			t.Errorf("ListRuns(%q) returned %d runs, want %d", site, len(runs), want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+// RunSummary describes the outcome of one ProcessURLs call
+type RunSummary struct {
+	PagesDone   int
+	PagesFailed int
+	Unfinished  int
+	Skipped     int
+	ItemsSaved  int
+	Errors      int
+
+	ArticlesSaved int
+
+	// Report breaks the run down by domain, saved as JSON with the run
+	Report RunReport
+}
+
+// StartRun records the start of a run and returns its id
+func StartRun(db *sql.DB, sites []string, startedAt time.Time) (int64, error) {
+	res, err := db.Exec("INSERT INTO runs (started_at, sites, status) VALUES (?, ?, ?)",
+		startedAt.UTC().Format(store.TimeLayout), strings.Join(sites, ","), "running")
+	if err != nil {
+		return 0, fmt.Errorf("failed to record run start: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// FinishRun records the end of a run with its counts. runErr is the error
+// ProcessURLs returned, if any; interrupted reports whether the run was
+// stopped early.
+func FinishRun(db *sql.DB, id int64, summary RunSummary, runErr error, interrupted bool) error {
+	status := "completed"
+	errText := ""
+	switch {
+	case runErr != nil:
+		status = "failed"
+		errText = runErr.Error()
+	case interrupted:
+		status = "interrupted"
+	}
+
+	report, err := json.Marshal(summary.Report)
+	if err != nil {
+		return fmt.Errorf("failed to encode run report: %w", err)
+	}
+
+	_, err = db.Exec(`UPDATE runs SET finished_at = ?, status = ?, items = ?, errors = ?,
+		pages_done = ?, pages_failed = ?, error = ?, report = ? WHERE id = ?`,
+		time.Now().UTC().Format(store.TimeLayout), status, summary.ItemsSaved, summary.Errors,
+		summary.PagesDone, summary.PagesFailed, errText, string(report), id)
+	if err != nil {
+		return fmt.Errorf("failed to record run end: %w", err)
+	}
+	return nil
+}
+
+// RunRecord is a row of the runs table
+type RunRecord struct {
+	ID          int64      `json:"id"`
+	StartedAt   string     `json:"started_at"`
+	FinishedAt  string     `json:"finished_at,omitempty"`
+	Sites       string     `json:"sites"`
+	Status      string     `json:"status"`
+	Items       int        `json:"items"`
+	Errors      int        `json:"errors"`
+	PagesDone   int        `json:"pages_done"`
+	PagesFailed int        `json:"pages_failed"`
+	Error       string     `json:"error,omitempty"`
+	Report      *RunReport `json:"report,omitempty"` // nil for runs recorded before reports
+}
+
+// likeEscaper escapes the LIKE wildcards in a site name
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// ListRuns returns the latest runs, newest first. With site set, only runs
+// that included it are returned.
+func ListRuns(db *sql.DB, site string, limit int) ([]RunRecord, error) {
+	rows, err := db.Query(`SELECT id, started_at, COALESCE(finished_at, ''), sites, status, items, errors,
+			pages_done, pages_failed, COALESCE(error, ''), COALESCE(report, '')
+		FROM runs
+		WHERE ? = '' OR ',' || sites || ',' LIKE '%,' || ? || ',%' ESCAPE '\'
+		ORDER BY id DESC LIMIT ?`, site, likeEscaper.Replace(site), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []RunRecord
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// LoadRun returns one run by id
+func LoadRun(db *sql.DB, id int64) (RunRecord, error) {
+	row := db.QueryRow(`SELECT id, started_at, COALESCE(finished_at, ''), sites, status, items, errors,
+			pages_done, pages_failed, COALESCE(error, ''), COALESCE(report, '')
+		FROM runs WHERE id = ?`, id)
+	run, err := scanRun(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, fmt.Errorf("no run with id %d", id)
+	}
+	return run, err
+}
+
+func scanRun(row interface{ Scan(...any) error }) (RunRecord, error) {
+	var run RunRecord
+	var startedAt, finishedAt any
+	var report string
+	err := row.Scan(&run.ID, &startedAt, &finishedAt, &run.Sites, &run.Status, &run.Items, &run.Errors,
+		&run.PagesDone, &run.PagesFailed, &run.Error, &report)
+	if err != nil {
+		return run, err
+	}
+	run.StartedAt = formatRunTime(startedAt)
+	run.FinishedAt = formatRunTime(finishedAt)
+	if report != "" {
+		run.Report = &RunReport{}
+		if err := json.Unmarshal([]byte(report), run.Report); err != nil {
+			return run, fmt.Errorf("failed to decode report of run %d: %w", run.ID, err)
+		}
+	}
+	return run, nil
+}
+
+// formatRunTime renders a runs timestamp, which the driver returns as a
+// time.Time for DATETIME columns
+func formatRunTime(v any) string {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC().Format(store.TimeLayout)
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	default:
+		return ""
+	}
+}
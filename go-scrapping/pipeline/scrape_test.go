@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+// stubFetcher serves canned HTML by URL without touching the network
+type stubFetcher struct {
+	pages     map[string]string
+	calls     []string
+	unchanged bool // report pages as served from the HTTP cache
+}
+
+func (f *stubFetcher) Fetch(ctx context.Context, pageURL string) (fetch.Result, error) {
+	f.calls = append(f.calls, pageURL)
+	html, ok := f.pages[pageURL]
+	if !ok {
+		return fetch.Result{Attempts: 1}, &fetch.StatusError{StatusCode: http.StatusNotFound}
+	}
+	return fetch.Result{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(html)),
+		Attempts:   1,
+		Unchanged:  f.unchanged,
+	}, nil
+}
+
+// newStubConfig scrapes spa.example with selectors, fetching through stub
+func newStubConfig(selectors extract.Selectors, stub *stubFetcher) Config {
+	config := Config{Extractors: extract.NewRegistry(), Fetchers: fetch.NewRegistry()}
+	config.Extractors.Register("spa.example", extract.NewSelectorExtractor("spa", selectors))
+	config.Fetchers.Register("spa.example", stub)
+	return config
+}
+
+func TestScrapeURLUsesSiteFetcher(t *testing.T) {
+	stub := &stubFetcher{pages: map[string]string{
+		"https://spa.example/list": `<ul>
+			<li class="post"><a href="/p/1">First</a> <span class="votes">10 votes</span></li>
+			<li class="post"><a href="https://other.example/2">Second</a> <span class="votes">3 votes</span></li>
+		</ul>`,
+	}}
+	config := newStubConfig(extract.Selectors{
+		Item:   "li.post",
+		Title:  "a",
+		Points: ".votes",
+	}, stub)
+
+	// No client: any request outside the stub would panic
+	page, err := scrapeURL(context.Background(), "https://spa.example/list", nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []extract.Item{
+		{Site: "spa", Title: "First", URL: "https://spa.example/p/1", Points: 10},
+		{Site: "spa", Title: "Second", URL: "https://other.example/2", Points: 3},
+	}
+	if !reflect.DeepEqual(page.Items, want) {
+		t.Errorf("items = %+v, want %+v", page.Items, want)
+	}
+	if page.StatusCode != http.StatusOK || page.Attempts != 1 {
+		t.Errorf("status = %d, attempts = %d, want 200 and 1", page.StatusCode, page.Attempts)
+	}
+	if len(stub.calls) != 1 {
+		t.Errorf("fetcher called %d times, want 1", len(stub.calls))
+	}
+}
+
+func TestScrapeURLExtractsUnchangedPagesOfRankedSites(t *testing.T) {
+	stub := &stubFetcher{unchanged: true, pages: map[string]string{
+		"https://spa.example/list": `<ol>
+			<li class="post"><span class="rank">1.</span> <a href="/p/1">First</a></li>
+			<li class="post"><span class="rank">2.</span> <a href="/p/2">Second</a></li>
+		</ol>`,
+	}}
+
+	// Ranked sites need every run's positions, even from a cached page
+	config := newStubConfig(extract.Selectors{Item: "li.post", Title: "a", Rank: ".rank"}, stub)
+	page, err := scrapeURL(context.Background(), "https://spa.example/list", nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Unchanged || len(page.Items) != 2 || page.Items[1].Rank != 2 {
+		t.Errorf("ranked page = %+v, want 2 ranked items from the cached copy", page)
+	}
+
+	// Other sites have nothing new to extract
+	config = newStubConfig(extract.Selectors{Item: "li.post", Title: "a"}, stub)
+	page, err = scrapeURL(context.Background(), "https://spa.example/list", nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Unchanged || len(page.Items) != 0 {
+		t.Errorf("unranked page = %+v, want no items", page)
+	}
+}
+
+func TestScrapeURLFallsBackToPageTitle(t *testing.T) {
+	stub := &stubFetcher{pages: map[string]string{
+		"https://spa.example/": `<html><head><title>Loading…</title></head><body><div id="root"></div></body></html>`,
+	}}
+	config := newStubConfig(extract.Selectors{Item: "li.post"}, stub)
+
+	page, err := scrapeURL(context.Background(), "https://spa.example/", nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Title != "Loading…" {
+		t.Errorf("items = %+v, want the page title only", page.Items)
+	}
+}
+
+func TestScrapeURLReportsFetchStatus(t *testing.T) {
+	stub := &stubFetcher{}
+	config := newStubConfig(extract.Selectors{Item: "li.post"}, stub)
+
+	page, err := scrapeURL(context.Background(), "https://spa.example/missing", nil, config)
+	if err == nil {
+		t.Fatal("expected an error for a missing page")
+	}
+	if page.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", page.StatusCode)
+	}
+}
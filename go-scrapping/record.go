@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+// runRecord implements `scraper record [flags] [URL...]`
+func runRecord(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	dir := fs.String("dir", "", "Fixture directory to save pages and their manifest to (required; the HN test fixtures are in ./testdata/hn)")
+	configPath := fs.String("config", "", "Record the seed and pagination URLs of this site config (defaults to Hacker News)")
+	userAgent := fs.String("user-agent", "GoScraper/1.0", "User-Agent for HTTP requests")
+	timeout := fs.Duration("timeout", 30*time.Second, "HTTP request timeout")
+	delay := fs.Duration("delay", time.Second, "Minimum delay between requests to the same host")
+	ignoreRobots := fs.Bool("ignore-robots", false, "Skip robots.txt checks (only for sites you own)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s record -dir DIR [flags] [URL...]\n\nSaves live pages as fixtures for tests and for offline runs with -replay.\nWithout URLs it records every page of the configured sites.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *dir == "" {
+		fs.Usage()
+		return errors.New("-dir is required")
+	}
+	fixtures, err := fetch.LoadFixtures(*dir)
+	if err != nil {
+		return err
+	}
+	logger, err := newLogger(os.Stderr, "text", "info", "record")
+	if err != nil {
+		return err
+	}
+
+	// The same politeness as a scrape: requests are spaced per host and
+	// robots.txt is honored
+	limiter := fetch.NewHostLimiter(fetch.Politeness{MinDelay: *delay, MaxConcurrency: 1})
+	client := &http.Client{
+		Timeout:   *timeout,
+		Transport: &fetch.RateLimitedTransport{Base: http.DefaultTransport, Limiter: limiter},
+	}
+	var robots *fetch.RobotsCache
+	if !*ignoreRobots {
+		robots = fetch.NewRobotsCache(client, *userAgent, limiter)
+	}
+	opts := fetch.Options{UserAgent: *userAgent, MaxRetries: 2, RetryBaseDelay: time.Second, RetryMaxDelay: 30 * time.Second}
+
+	urls := fs.Args()
+	if len(urls) == 0 {
+		sites := defaultSitesConfig()
+		if *configPath != "" {
+			if sites, err = loadSitesConfig(*configPath); err != nil {
+				return err
+			}
+		}
+		urls = getURLsToScrape(context.Background(), sites, client, opts, logger)
+	}
+
+	if failed := recordPages(context.Background(), fixtures, urls, client, robots, opts, logger); failed > 0 {
+		return fmt.Errorf("failed to record %d of %d pages", failed, len(urls))
+	}
+	return nil
+}
+
+// recordPages saves every page robots.txt allows, carrying on past pages
+// that fail, and returns how many failed. robots may be nil.
+func recordPages(ctx context.Context, fixtures *fetch.Fixtures, urls []string, client *http.Client, robots *fetch.RobotsCache, opts fetch.Options, logger *slog.Logger) int {
+	failed := 0
+	for _, pageURL := range urls {
+		if robots != nil {
+			allowed, err := robots.Allowed(ctx, pageURL)
+			if err != nil {
+				logger.Error("Failed to record page", "url", pageURL, "error", err)
+				failed++
+				continue
+			}
+			if !allowed {
+				logger.Info("Skipping URL disallowed by robots.txt", "url", pageURL)
+				continue
+			}
+		}
+
+		name, err := recordPage(ctx, fixtures, pageURL, client, opts)
+		if err != nil {
+			logger.Error("Failed to record page", "url", pageURL, "error", err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s -> %s\n", pageURL, name)
+	}
+	return failed
+}
+
+// recordPage fetches pageURL and saves its body to the fixtures
+func recordPage(ctx context.Context, fixtures *fetch.Fixtures, pageURL string, client *http.Client, opts fetch.Options) (string, error) {
+	resp, _, err := fetch.Get(ctx, pageURL, client, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", pageURL, err)
+	}
+	return fixtures.Save(pageURL, body)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+func TestRecordPagesSkipsDisallowedAndContinuesPastErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			io.WriteString(w, "User-agent: *\nDisallow: /private\n")
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			io.WriteString(w, "<html>"+r.URL.Path+"</html>")
+		}
+	}))
+	defer srv.Close()
+
+	fixtures, err := fetch.LoadFixtures(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	robots := fetch.NewRobotsCache(srv.Client(), "test-agent", fetch.NewHostLimiter(fetch.Politeness{}))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	urls := []string{srv.URL + "/a", srv.URL + "/missing", srv.URL + "/private", srv.URL + "/b"}
+
+	failed := recordPages(context.Background(), fixtures, urls, srv.Client(), robots, fetch.Options{}, logger)
+	if failed != 1 {
+		t.Errorf("%d pages failed, want the missing one", failed)
+	}
+
+	// The pages after the failure were recorded, the disallowed one wasn't
+	recorded := make(map[string]bool)
+	for _, pageURL := range fixtures.Pages() {
+		recorded[pageURL] = true
+	}
+	if len(recorded) != 2 || !recorded[srv.URL+"/a"] || !recorded[srv.URL+"/b"] {
+		t.Errorf("recorded %v, want /a and /b", recorded)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+// Snapshot is a ranked item as captured by one run
+type Snapshot struct {
+	ItemID   string `json:"item_id,omitempty"`
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Rank     int    `json:"rank"`
+	Points   int    `json:"points"`
+	Comments int    `json:"comments"`
+}
+
+// RankChange describes how one story's position differs between two runs.
+// OldRank is 0 for stories that entered and NewRank is 0 for those that left.
+type RankChange struct {
+	Snapshot
+	OldRank     int `json:"old_rank,omitempty"`
+	NewRank     int `json:"new_rank,omitempty"`
+	PointsDelta int `json:"points_delta,omitempty"`
+}
+
+// RankReport compares the ranked listing of two runs
+type RankReport struct {
+	FromRun int64        `json:"from_run"`
+	ToRun   int64        `json:"to_run"`
+	Entered []RankChange `json:"entered"`
+	Left    []RankChange `json:"left"`
+	Moved   []RankChange `json:"moved"`
+}
+
+// runReport implements `scraper report [flags]`
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	dbPath := fs.String("db", "./scraped_titles.db", "Path to SQLite database file")
+	from := fs.Int64("from", 0, "Run id to compare from (default: the second latest run with snapshots)")
+	to := fs.Int64("to", 0, "Run id to compare to (default: the latest run with snapshots)")
+	site := fs.String("site", "", "Only compare stories from this site")
+	top := fs.Int("top", 30, "Only consider stories ranked this high or better; 0 for all")
+	format := fs.String("format", "table", "Output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s report [flags]\n\nShows stories that entered, left or moved in the ranking between two runs.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	db, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := store.Migrate(db); err != nil {
+		return err
+	}
+
+	if *from == 0 || *to == 0 {
+		latest, err := snapshotRuns(db, *site, 2)
+		if err != nil {
+			return err
+		}
+		if len(latest) < 2 {
+			return fmt.Errorf("need two runs with rank snapshots to compare, found %d", len(latest))
+		}
+		if *to == 0 {
+			*to = latest[0]
+		}
+		if *from == 0 {
+			*from = latest[1]
+		}
+	}
+
+	before, err := loadSnapshots(db, *from, *site, *top)
+	if err != nil {
+		return err
+	}
+	after, err := loadSnapshots(db, *to, *site, *top)
+	if err != nil {
+		return err
+	}
+	report := diffSnapshots(before, after)
+	report.FromRun, report.ToRun = *from, *to
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "table":
+		return writeRankReport(os.Stdout, report)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+// snapshotRuns returns the ids of the latest runs that recorded snapshots,
+// newest first
+func snapshotRuns(db *sql.DB, site string, limit int) ([]int64, error) {
+	rows, err := db.Query(`SELECT DISTINCT run_id FROM snapshots
+		WHERE ? = '' OR site = ?
+		ORDER BY run_id DESC LIMIT ?`, site, site, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// loadSnapshots returns a run's ranked items keyed by item id, or by
+// normalized URL for sites without ids
+func loadSnapshots(db *sql.DB, runID int64, site string, top int) (map[string]Snapshot, error) {
+	rows, err := db.Query(`SELECT COALESCE(NULLIF(item_id, ''), url_key), COALESCE(item_id, ''),
+			title, url, rank, points, comments
+		FROM snapshots
+		WHERE run_id = ? AND (? = '' OR site = ?) AND (? = 0 OR rank <= ?)`,
+		runID, site, site, top, top)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := make(map[string]Snapshot)
+	for rows.Next() {
+		var key string
+		var s Snapshot
+		if err := rows.Scan(&key, &s.ItemID, &s.Title, &s.URL, &s.Rank, &s.Points, &s.Comments); err != nil {
+			return nil, err
+		}
+		// A story listed twice in one run keeps its best rank
+		if prev, ok := snapshots[key]; ok && prev.Rank <= s.Rank {
+			continue
+		}
+		snapshots[key] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("run %d has no snapshots", runID)
+	}
+	return snapshots, nil
+}
+
+// diffSnapshots lists stories that entered, left or changed rank. Entered
+// and moved stories are ordered by their new rank, left ones by their old rank.
+func diffSnapshots(before, after map[string]Snapshot) RankReport {
+	var report RankReport
+	for key, now := range after {
+		prev, ok := before[key]
+		switch {
+		case !ok:
+			report.Entered = append(report.Entered, RankChange{Snapshot: now, NewRank: now.Rank})
+		case prev.Rank != now.Rank:
+			report.Moved = append(report.Moved, RankChange{
+				Snapshot:    now,
+				OldRank:     prev.Rank,
+				NewRank:     now.Rank,
+				PointsDelta: now.Points - prev.Points,
+			})
+		}
+	}
+	for key, prev := range before {
+		if _, ok := after[key]; !ok {
+			report.Left = append(report.Left, RankChange{Snapshot: prev, OldRank: prev.Rank})
+		}
+	}
+
+	sort.Slice(report.Entered, func(i, j int) bool { return report.Entered[i].NewRank < report.Entered[j].NewRank })
+	sort.Slice(report.Moved, func(i, j int) bool { return report.Moved[i].NewRank < report.Moved[j].NewRank })
+	sort.Slice(report.Left, func(i, j int) bool { return report.Left[i].OldRank < report.Left[j].OldRank })
+	return report
+}
+
+func writeRankReport(w io.Writer, report RankReport) error {
+	fmt.Fprintf(w, "Changes from run %d to run %d\n", report.FromRun, report.ToRun)
+	if len(report.Entered)+len(report.Left)+len(report.Moved) == 0 {
+		_, err := fmt.Fprintln(w, "\nNo changes.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if len(report.Entered) > 0 {
+		fmt.Fprintf(tw, "\nENTERED (%d)\nRANK\tPOINTS\tCOMMENTS\tTITLE\n", len(report.Entered))
+		for _, c := range report.Entered {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%s\n", c.NewRank, c.Points, c.Comments, truncate(c.Title, 70))
+		}
+	}
+	if len(report.Moved) > 0 {
+		fmt.Fprintf(tw, "\nMOVED (%d)\nRANK\tCHANGE\tPOINTS\tTITLE\n", len(report.Moved))
+		for _, c := range report.Moved {
+			fmt.Fprintf(tw, "%d\t%+d (was %d)\t%d (%+d)\t%s\n",
+				c.NewRank, c.OldRank-c.NewRank, c.OldRank, c.Points, c.PointsDelta, truncate(c.Title, 70))
+		}
+	}
+	if len(report.Left) > 0 {
+		fmt.Fprintf(tw, "\nLEFT (%d)\nWAS\tPOINTS\tCOMMENTS\tTITLE\n", len(report.Left))
+		for _, c := range report.Left {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%s\n", c.OldRank, c.Points, c.Comments, truncate(c.Title, 70))
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	before := map[string]Snapshot{
+		"1": {ItemID: "1", Title: "Stays", Rank: 1, Points: 100},
+		"2": {ItemID: "2", Title: "Drops", Rank: 2, Points: 50},
+		"3": {ItemID: "3", Title: "Leaves", Rank: 3, Points: 10},
+	}
+	after := map[string]Snapshot{
+		"1": {ItemID: "1", Title: "Stays", Rank: 1, Points: 120},
+		"4": {ItemID: "4", Title: "Enters", Rank: 2, Points: 80},
+		"2": {ItemID: "2", Title: "Drops", Rank: 3, Points: 55},
+	}
+
+	report := diffSnapshots(before, after)
+
+	want := RankReport{
+		Entered: []RankChange{{Snapshot: after["4"], NewRank: 2}},
+		Left:    []RankChange{{Snapshot: before["3"], OldRank: 3}},
+		Moved:   []RankChange{{Snapshot: after["2"], OldRank: 2, NewRank: 3, PointsDelta: 5}},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("diffSnapshots() = %+v, want %+v", report, want)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/NoxturneDev/hn-scrapper/pipeline"
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+// runRuns implements `scraper runs [flags]`
+func runRuns(args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ExitOnError)
+	dbPath := fs.String("db", "./scraped_titles.db", "Path to SQLite database file")
+	id := fs.Int64("id", 0, "Show the full report of this run instead of listing runs")
+	site := fs.String("site", "", "Only list runs that scraped this site")
+	limit := fs.Int("limit", 20, "Maximum number of runs to list")
+	format := fs.String("format", "table", "Output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s runs [flags]\n\nLists recent runs with their item counts, or shows one run's per-domain report.\nDomains that were scraped but yielded no items are flagged, which usually\nmeans the site changed its markup.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	db, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := store.Migrate(db); err != nil {
+		return err
+	}
+
+	var result any
+	var writeTable func(io.Writer) error
+	if *id != 0 {
+		run, err := pipeline.LoadRun(db, *id)
+		if err != nil {
+			return err
+		}
+		result = run
+		writeTable = func(w io.Writer) error { return writeRun(w, run) }
+	} else {
+		runs, err := pipeline.ListRuns(db, *site, *limit)
+		if err != nil {
+			return err
+		}
+		result = runs
+		writeTable = func(w io.Writer) error { return writeRunList(w, runs) }
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	case "table":
+		return writeTable(os.Stdout)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func writeRunList(w io.Writer, runs []pipeline.RunRecord) error {
+	if len(runs) == 0 {
+		fmt.Fprintln(w, "No runs recorded yet")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTARTED\tSTATUS\tSITES\tITEMS\tPAGES\tFAILED\tP95\tNO ITEMS FROM")
+	for _, run := range runs {
+		p95, empty := "-", ""
+		if run.Report != nil {
+			p95 = fmt.Sprintf("%.0fms", run.Report.LatencyP95)
+			empty = strings.Join(run.Report.EmptyDomains(), ",")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n", run.ID, run.StartedAt, run.Status,
+			truncate(run.Sites, 30), run.Items, run.PagesDone, run.PagesFailed, p95, empty)
+	}
+	return tw.Flush()
+}
+
+func writeRun(w io.Writer, run pipeline.RunRecord) error {
+	fmt.Fprintf(w, "Run %d (%s): %s, started %s", run.ID, run.Sites, run.Status, run.StartedAt)
+	if run.FinishedAt != "" {
+		fmt.Fprintf(w, ", finished %s", run.FinishedAt)
+	}
+	fmt.Fprintln(w)
+	if run.Error != "" {
+		fmt.Fprintf(w, "Error: %s\n", run.Error)
+	}
+	fmt.Fprintln(w)
+
+	if run.Report == nil {
+		fmt.Fprintln(w, "No report was saved for this run")
+		return nil
+	}
+	if err := run.Report.WriteTable(w); err != nil {
+		return err
+	}
+	if empty := run.Report.EmptyDomains(); len(empty) > 0 {
+		fmt.Fprintf(w, "\nNo items extracted from %s, check their selectors\n", strings.Join(empty, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+// SearchResult is one row returned by the search subcommand
+type SearchResult struct {
+	ID        int64   `json:"id"`
+	Title     string  `json:"title"`
+	URL       string  `json:"url"`
+	CreatedAt string  `json:"created_at"`
+	Score     float64 `json:"score"` // higher is a better match
+}
+
+// SearchOptions narrows a full-text query
+type SearchOptions struct {
+	Query string
+	Since time.Time // zero = no lower bound on created_at
+	Until time.Time // zero = no upper bound on created_at
+	Limit int
+}
+
+// runSearch implements `scraper search [flags] QUERY`
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	dbPath := fs.String("db", "./scraped_titles.db", "Path to SQLite database file")
+	since := fs.String("since", "", "Only titles created on or after this date (YYYY-MM-DD or RFC 3339)")
+	until := fs.String("until", "", "Only titles created before this date (YYYY-MM-DD or RFC 3339)")
+	limit := fs.Int("limit", 20, "Maximum number of results")
+	format := fs.String("format", "table", "Output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s search [flags] QUERY\n\nQUERY uses SQLite FTS5 syntax, e.g. 'golang OR rust', '\"open source\"', 'title:postgres'.\nBuilds without FTS5 (see the Makefile) list the newest titles containing every word.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts := SearchOptions{Query: strings.Join(fs.Args(), " "), Limit: *limit}
+	if opts.Query == "" {
+		fs.Usage()
+		return fmt.Errorf("missing search query")
+	}
+	var err error
+	if opts.Since, err = parseDateFlag(*since); err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+	if opts.Until, err = parseDateFlag(*until); err != nil {
+		return fmt.Errorf("invalid -until: %w", err)
+	}
+
+	db, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := store.Migrate(db); err != nil {
+		return err
+	}
+	fts, err := store.EnsureSearchIndex(db)
+	if err != nil {
+		return err
+	}
+
+	results, err := searchTitles(db, opts, fts)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		return writeSearchJSON(os.Stdout, results)
+	case "table":
+		return writeSearchTable(os.Stdout, results)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func parseDateFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// searchTitles runs a ranked full-text query when fts is set. Title matches
+// weigh more than URL matches; the best match comes first. Without FTS5 it
+// falls back to LIKE, matching titles that contain every word of the query
+// and scoring each word 10 for a title match and 1 for a URL match, newest
+// first among equal scores.
+func searchTitles(db *sql.DB, opts SearchOptions, fts bool) ([]SearchResult, error) {
+	var query string
+	var args []any
+	if fts {
+		query = `SELECT t.id, t.title, t.url, t.created_at, bm25(titles_fts, 10.0, 1.0) AS rank
+			FROM titles_fts
+			JOIN titles t ON t.id = titles_fts.rowid
+			WHERE titles_fts MATCH ?`
+		args = append(args, opts.Query)
+	} else {
+		// rank is negated like bm25(), so both are sorted the same way
+		var scores, filters []string
+		var filterArgs []any
+		for _, word := range strings.Fields(opts.Query) {
+			pattern := "%" + likeEscaper.Replace(word) + "%"
+			scores = append(scores, `(t.title LIKE ? ESCAPE '\') * 10 + (t.url LIKE ? ESCAPE '\')`)
+			filters = append(filters, ` AND (t.title LIKE ? ESCAPE '\' OR t.url LIKE ? ESCAPE '\')`)
+			args = append(args, pattern, pattern)
+			filterArgs = append(filterArgs, pattern, pattern)
+		}
+		rank := "0"
+		if len(scores) > 0 {
+			rank = "-(" + strings.Join(scores, " + ") + ")"
+		}
+		query = "SELECT t.id, t.title, t.url, t.created_at, " + rank + " AS rank FROM titles t WHERE 1 = 1" + strings.Join(filters, "")
+		args = append(args, filterArgs...)
+	}
+
+	if !opts.Since.IsZero() {
+		query += " AND t.created_at >= ?"
+		args = append(args, opts.Since.UTC().Format(store.TimeLayout))
+	}
+	if !opts.Until.IsZero() {
+		query += " AND t.created_at < ?"
+		args = append(args, opts.Until.UTC().Format(store.TimeLayout))
+	}
+	query += " ORDER BY rank, t.created_at DESC, t.id DESC LIMIT ?"
+	args = append(args, opts.Limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var createdAt time.Time
+		var rank float64
+		if err := rows.Scan(&r.ID, &r.Title, &r.URL, &createdAt, &rank); err != nil {
+			return nil, err
+		}
+		// bm25() is negative with the best match lowest; flip it for display,
+		// leaving a zero rank positive
+		if rank != 0 {
+			r.Score = -rank
+		}
+		r.CreatedAt = createdAt.UTC().Format(store.TimeLayout)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// likeEscaper escapes the LIKE wildcards in a search word
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func writeSearchTable(w io.Writer, results []SearchResult) error {
+	if len(results) == 0 {
+		_, err := fmt.Fprintln(w, "No results.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCORE\tCREATED\tTITLE\tURL")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%.2f\t%s\t%s\t%s\n", r.Score, r.CreatedAt, truncate(r.Title, 70), r.URL)
+	}
+	return tw.Flush()
+}
+
+func writeSearchJSON(w io.Writer, results []SearchResult) error {
+	if results == nil {
+		results = []SearchResult{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+func TestSearchTitlesFindsNewTitles(t *testing.T) {
+	db, err := store.Open(store.MemoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := store.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	fts, err := store.EnsureSearchIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Titles saved after the index was created are searchable right away
+	sink, err := store.OpenSinks([]string{"sqlite"}, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	err = sink.WriteBatch([]extract.Item{
+		{Title: "Rust in the Linux kernel", URL: "https://example.com/rust"},
+		{Title: "Go 1.23 released", URL: "https://go.dev/blog/go1.23"},
+		{Title: "100% uptime", URL: "https://example.com/uptime"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{"rust", "Rust in the Linux kernel"},
+		{"released", "Go 1.23 released"},
+	} {
+		results, err := searchTitles(db, SearchOptions{Query: tt.query, Limit: 10}, fts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Title != tt.want {
+			t.Errorf("search %q (fts=%v) = %+v, want %q", tt.query, fts, results, tt.want)
+		}
+	}
+
+	// The LIKE fallback matches wildcards literally
+	results, err := searchTitles(db, SearchOptions{Query: "0%", Limit: 10}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Title != "100% uptime" {
+		t.Errorf("LIKE search for %q = %+v", "0%", results)
+	}
+}
+
+func TestSearchTitlesLIKERanksTitleMatchesFirst(t *testing.T) {
+	db, err := store.Open(store.MemoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := store.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := store.OpenSinks([]string{"sqlite"}, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	err = sink.WriteBatch([]extract.Item{
+		{Title: "Go 1.23 released", URL: "https://go.dev/blog/go1.23"},
+		{Title: "A new release", URL: "https://example.com/golang"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The title match outranks the newer URL-only match, and scores are
+	// positive like FTS5's
+	results, err := searchTitles(db, SearchOptions{Query: "go", Limit: 10}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Title != "Go 1.23 released" {
+		t.Fatalf("LIKE search = %+v, want the title match first", results)
+	}
+	if results[0].Score <= results[1].Score || results[1].Score <= 0 {
+		t.Errorf("scores = %v, %v; want positive and the title match higher", results[0].Score, results[1].Score)
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+//go:embed templates/dashboard.html
+var templateFS embed.FS
+
+var dashboardTemplate = template.Must(template.New("dashboard.html").Funcs(template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"sub": func(a, b int) int { return a - b },
+	"mul": func(a, b int) int { return a * b },
+	"percent": func(n, total int) int {
+		if total == 0 {
+			return 0
+		}
+		return n * 100 / total
+	},
+}).ParseFS(templateFS, "templates/dashboard.html"))
+
+// TitleRow is a titles table row as exposed by the HTTP API
+type TitleRow struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	CreatedAt   string `json:"created_at"`
+	FirstSeenAt string `json:"first_seen_at,omitempty"`
+	LastSeenAt  string `json:"last_seen_at,omitempty"`
+}
+
+// TitlePage is one page of the paginated titles list
+type TitlePage struct {
+	Items   []TitleRow `json:"items"`
+	Page    int        `json:"page"`
+	PerPage int        `json:"per_page"`
+	Total   int        `json:"total"`
+}
+
+// DayCount is one bar of the per-day histogram
+type DayCount struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// server exposes the scraped data over HTTP
+type server struct {
+	db     *sql.DB
+	logger *slog.Logger
+
+	// fts is set when titles can be searched with FTS5, see searchTitles
+	fts bool
+}
+
+// runServe implements `scraper serve [flags]`
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dbPath := fs.String("db", "./scraped_titles.db", "Path to SQLite database file")
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	logFormat := fs.String("log-format", "json", "Log output format: json or text")
+	logLevel := fs.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	fs.Parse(args)
+
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel, "server")
+	if err != nil {
+		return err
+	}
+
+	db, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := store.Migrate(db); err != nil {
+		return err
+	}
+
+	fts, err := store.EnsureSearchIndex(db)
+	if err != nil {
+		return err
+	}
+	if !fts {
+		logger.Warn("Built without FTS5, searching titles with LIKE instead")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s := &server{db: db, logger: logger, fts: fts}
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	logger.Info("Serving database", "db", *dbPath, "addr", *addr)
+	return listenAndServe(ctx, srv, logger)
+}
+
+// serverShutdownTimeout bounds how long open requests may take to finish
+// once the server is asked to stop
+const serverShutdownTimeout = 10 * time.Second
+
+// listenAndServe runs srv until it fails or ctx is canceled, then shuts it
+// down, letting open requests finish
+func listenAndServe(ctx context.Context, srv *http.Server, logger *slog.Logger) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down server", "timeout", serverShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	return nil
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleDashboard)
+	mux.HandleFunc("GET /api/titles", s.handleTitles)
+	mux.HandleFunc("GET /api/search", s.handleSearch)
+	mux.HandleFunc("GET /api/histogram", s.handleHistogram)
+	mux.HandleFunc("GET /api/export", s.handleExport)
+	return mux
+}
+
+func (s *server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	page, perPage := pagination(r)
+	query := r.URL.Query().Get("q")
+
+	data := struct {
+		Query     string
+		Titles    TitlePage
+		Results   []SearchResult
+		Histogram []DayCount
+		MaxCount  int
+		Error     string
+	}{Query: query}
+
+	var err error
+	if query != "" {
+		data.Results, err = s.search(query, perPage)
+	} else {
+		data.Titles, err = s.listTitles(page, perPage)
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+
+	if data.Histogram, err = s.histogram(30); err != nil && data.Error == "" {
+		data.Error = err.Error()
+	}
+	for _, d := range data.Histogram {
+		data.MaxCount = max(data.MaxCount, d.Count)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		s.logger.Error("Failed to render dashboard", "error", err)
+	}
+}
+
+func (s *server) handleTitles(w http.ResponseWriter, r *http.Request) {
+	page, perPage := pagination(r)
+	titles, err := s.listTitles(page, perPage)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeJSON(w, titles)
+}
+
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("missing q parameter"))
+		return
+	}
+	_, perPage := pagination(r)
+	results, err := s.search(query, perPage)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if results == nil {
+		results = []SearchResult{}
+	}
+	s.writeJSON(w, results)
+}
+
+func (s *server) handleHistogram(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && v > 0 {
+		days = min(v, 3650)
+	}
+	counts, err := s.histogram(days)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeJSON(w, counts)
+}
+
+// exportChunkRows is how many rows an export writes before pushing its write
+// deadline back by exportWriteTimeout. The server's WriteTimeout would cut a
+// large export short otherwise.
+const (
+	exportChunkRows    = 1000
+	exportWriteTimeout = 30 * time.Second
+)
+
+// handleExport streams every title as a JSON array, so large tables don't
+// have to fit in memory. An export that fails partway aborts the connection
+// so the client can't mistake it for a complete one.
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	extendDeadline := func() {
+		err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			s.logger.Warn("Failed to extend export write deadline", "error", err)
+		}
+	}
+	extendDeadline()
+
+	rows, err := s.db.QueryContext(r.Context(), `SELECT id, title, url, created_at,
+		COALESCE(first_seen_at, ''), COALESCE(last_seen_at, '') FROM titles ORDER BY id`)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="titles.json"`)
+	enc := json.NewEncoder(w)
+
+	abort := func(err error) {
+		s.logger.Error("Export failed", "error", err)
+		panic(http.ErrAbortHandler)
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		abort(err)
+	}
+	n := 0
+	for rows.Next() {
+		row, err := scanTitleRow(rows)
+		if err != nil {
+			abort(err)
+		}
+		if n > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				abort(err)
+			}
+			if n%exportChunkRows == 0 {
+				extendDeadline()
+			}
+		}
+		if err := enc.Encode(row); err != nil {
+			abort(err)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		abort(err)
+	}
+	if _, err := io.WriteString(w, "]\n"); err != nil {
+		abort(err)
+	}
+}
+
+func (s *server) listTitles(page, perPage int) (TitlePage, error) {
+	result := TitlePage{Page: page, PerPage: perPage, Items: []TitleRow{}}
+
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM titles").Scan(&result.Total); err != nil {
+		return result, fmt.Errorf("failed to count titles: %w", err)
+	}
+
+	rows, err := s.db.Query(`SELECT id, title, url, created_at,
+		COALESCE(first_seen_at, ''), COALESCE(last_seen_at, '')
+		FROM titles ORDER BY id DESC LIMIT ? OFFSET ?`, perPage, (page-1)*perPage)
+	if err != nil {
+		return result, fmt.Errorf("failed to list titles: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := scanTitleRow(rows)
+		if err != nil {
+			return result, err
+		}
+		result.Items = append(result.Items, row)
+	}
+	return result, rows.Err()
+}
+
+func scanTitleRow(rows *sql.Rows) (TitleRow, error) {
+	var row TitleRow
+	var createdAt time.Time
+	if err := rows.Scan(&row.ID, &row.Title, &row.URL, &createdAt, &row.FirstSeenAt, &row.LastSeenAt); err != nil {
+		return row, err
+	}
+	row.CreatedAt = createdAt.UTC().Format(store.TimeLayout)
+	return row, nil
+}
+
+// search runs a full-text query
+func (s *server) search(query string, limit int) ([]SearchResult, error) {
+	return searchTitles(s.db, SearchOptions{Query: query, Limit: limit}, s.fts)
+}
+
+// histogram counts titles per day of created_at over the last n days
+func (s *server) histogram(days int) ([]DayCount, error) {
+	since := time.Now().UTC().AddDate(0, 0, -days).Format(time.DateOnly)
+	rows, err := s.db.Query(`SELECT date(created_at) AS day, COUNT(*)
+		FROM titles WHERE created_at >= ? GROUP BY day ORDER BY day`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build histogram: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []DayCount{}
+	for rows.Next() {
+		var d DayCount
+		if err := rows.Scan(&d.Day, &d.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, d)
+	}
+	return counts, rows.Err()
+}
+
+// pagination reads page and per_page query parameters with sane bounds
+func pagination(r *http.Request) (page, perPage int) {
+	page, perPage = 1, 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && v > 0 {
+		page = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && v > 0 {
+		perPage = min(v, 500)
+	}
+	return page, perPage
+}
+
+func (s *server) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error("Failed to write response", "error", err)
+	}
+}
+
+func (s *server) writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
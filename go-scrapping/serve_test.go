@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+func TestListenAndServeShutsDownOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	done := make(chan error, 1)
+	go func() { done <- listenAndServe(ctx, srv, logger) }()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("listenAndServe() = %v, want nil after shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server still running after its context was canceled")
+	}
+}
+
+// newTestServer returns a server over an in-memory database holding n titles
+func newTestServer(t *testing.T, n int) *server {
+	t.Helper()
+	db, err := store.Open(store.MemoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := store.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	fts, err := store.EnsureSearchIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := store.OpenSinks([]string{"sqlite"}, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	items := make([]extract.Item, n)
+	for i := range items {
+		items[i] = extract.Item{Title: fmt.Sprintf("Story %d", i), URL: fmt.Sprintf("https://example.com/%d", i)}
+	}
+	items[0].Title = "Rust in the Linux kernel"
+	if err := sink.WriteBatch(items); err != nil {
+		t.Fatal(err)
+	}
+	return &server{db: db, logger: slog.New(slog.NewTextHandler(io.Discard, nil)), fts: fts}
+}
+
+// getJSON fetches path from srv and decodes the JSON response into v
+func getJSON(t *testing.T, srv *httptest.Server, path string, v any) {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+}
+
+func TestServeAPI(t *testing.T) {
+	s := newTestServer(t, 5)
+	srv := httptest.NewServer(s.routes())
+	defer srv.Close()
+
+	// Titles are listed newest first, a page at a time
+	var page TitlePage
+	getJSON(t, srv, "/api/titles?page=2&per_page=2", &page)
+	if page.Total != 5 || page.Page != 2 || len(page.Items) != 2 || page.Items[0].Title != "Story 2" {
+		t.Errorf("titles page = %+v, want Story 2 and 1 of 5", page)
+	}
+
+	var results []SearchResult
+	getJSON(t, srv, "/api/search?q=rust", &results)
+	if len(results) != 1 || results[0].Title != "Rust in the Linux kernel" {
+		t.Errorf("search results = %+v, want the Rust story", results)
+	}
+	resp, err := srv.Client().Get(srv.URL + "/api/search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("search without q: status %d, want 400", resp.StatusCode)
+	}
+
+	// Every title was saved today
+	var days []DayCount
+	getJSON(t, srv, "/api/histogram?days=7", &days)
+	if len(days) != 1 || days[0].Count != 5 || days[0].Day != time.Now().UTC().Format(time.DateOnly) {
+		t.Errorf("histogram = %+v, want 5 titles today", days)
+	}
+}
+
+func TestServeExport(t *testing.T) {
+	s := newTestServer(t, 2*exportChunkRows+1)
+
+	// The handler starts after the server's WriteTimeout has passed, so the
+	// export only succeeds if it extends its write deadline
+	handler := s.routes()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		handler.ServeHTTP(w, r)
+	}))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	var rows []TitleRow
+	getJSON(t, srv, "/api/export", &rows)
+	if len(rows) != 2*exportChunkRows+1 {
+		t.Fatalf("exported %d rows, want %d", len(rows), 2*exportChunkRows+1)
+	}
+	for i, row := range rows {
+		if row.ID != int64(i+1) {
+			t.Fatalf("row %d has id %d, want rows in id order", i, row.ID)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package source
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+// Feed lists the entry links of an RSS 2.0, RSS 1.0 or Atom feed
+type Feed struct {
+	URL     string
+	Client  *http.Client
+	Options fetch.Options
+}
+
+// feedDocument covers the three feed formats: RSS 2.0 items live in
+// <channel>, RSS 1.0 items and Atom entries at the root
+type feedDocument struct {
+	XMLName xml.Name
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Links []string `xml:"link"`
+	GUID  struct {
+		Value       string `xml:",chardata"`
+		IsPermaLink string `xml:"isPermaLink,attr"`
+	} `xml:"guid"`
+}
+
+type atomEntry struct {
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+}
+
+func (s *Feed) URLs(ctx context.Context) ([]string, error) {
+	base, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed URL: %w", err)
+	}
+	body, err := download(ctx, s.URL, s.Client, s.Options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	links, err := parseFeed(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feed %s: %w", s.URL, err)
+	}
+
+	var urls []string
+	for _, link := range links {
+		if u := resolve(base, link); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
+// parseFeed returns the link of each item or entry, in feed order
+func parseFeed(data []byte) ([]string, error) {
+	var doc feedDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var links []string
+	switch doc.XMLName.Local {
+	case "rss", "RDF":
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			if link := item.link(); link != "" {
+				links = append(links, link)
+			}
+		}
+	case "feed":
+		for _, entry := range doc.Entries {
+			if link := entry.link(); link != "" {
+				links = append(links, link)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected root element <%s>", doc.XMLName.Local)
+	}
+	return links, nil
+}
+
+// link returns the item's <link>, falling back to a permalink <guid>. An
+// <atom:link> inside the item has no text and is skipped.
+func (i rssItem) link() string {
+	for _, link := range i.Links {
+		if link = strings.TrimSpace(link); link != "" {
+			return link
+		}
+	}
+	guid := strings.TrimSpace(i.GUID.Value)
+	if i.GUID.IsPermaLink != "false" && (strings.HasPrefix(guid, "http://") || strings.HasPrefix(guid, "https://")) {
+		return guid
+	}
+	return ""
+}
+
+// link returns the entry's alternate link, the page the entry is about
+func (e atomEntry) link() string {
+	for _, link := range e.Links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	return ""
+}
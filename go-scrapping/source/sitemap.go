@@ -0,0 +1,93 @@
+package source
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+// maxSitemapDepth bounds how deep sitemap indexes are followed. The protocol
+// doesn't allow nested indexes, but some sites nest them anyway.
+const maxSitemapDepth = 3
+
+// Sitemap lists the pages of a sitemap.xml, following sitemap indexes to the
+// sitemaps they reference. Gzipped sitemaps are supported.
+type Sitemap struct {
+	URL     string
+	Client  *http.Client
+	Options fetch.Options
+}
+
+// sitemapDocument is either a <urlset> or a <sitemapindex>
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+func (s *Sitemap) URLs(ctx context.Context) ([]string, error) {
+	var urls []string
+	seen := make(map[string]bool)
+	if err := s.collect(ctx, s.URL, 0, seen, &urls); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+func (s *Sitemap) collect(ctx context.Context, sitemapURL string, depth int, seen map[string]bool, urls *[]string) error {
+	if seen[sitemapURL] {
+		return nil
+	}
+	seen[sitemapURL] = true
+
+	base, err := url.Parse(sitemapURL)
+	if err != nil {
+		return fmt.Errorf("invalid sitemap URL: %w", err)
+	}
+	body, err := download(ctx, sitemapURL, s.Client, s.Options)
+	if err != nil {
+		return fmt.Errorf("failed to fetch sitemap: %w", err)
+	}
+	doc, err := parseSitemap(body)
+	if err != nil {
+		return fmt.Errorf("failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+
+	for _, loc := range doc.URLs {
+		if u := resolve(base, loc.Loc); u != "" {
+			*urls = append(*urls, u)
+		}
+	}
+	if len(doc.Sitemaps) > 0 && depth+1 >= maxSitemapDepth {
+		return fmt.Errorf("sitemap index %s nests deeper than %d levels", sitemapURL, maxSitemapDepth)
+	}
+	for _, loc := range doc.Sitemaps {
+		if u := resolve(base, loc.Loc); u != "" {
+			if err := s.collect(ctx, u, depth+1, seen, urls); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parseSitemap(data []byte) (*sitemapDocument, error) {
+	var doc sitemapDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+		return &doc, nil
+	default:
+		return nil, fmt.Errorf("unexpected root element <%s>", doc.XMLName.Local)
+	}
+}
@@ -0,0 +1,94 @@
+// Package source lists the page URLs of a site from its sitemap, an RSS or
+// Atom feed, or a plain file, as an alternative to generated pagination
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+// maxDocumentSize caps how much of a sitemap or feed is read, the sitemap
+// protocol allows 50MB uncompressed
+const maxDocumentSize = 50 << 20
+
+// Source lists page URLs to scrape
+type Source interface {
+	URLs(ctx context.Context) ([]string, error)
+}
+
+// File reads one URL per line from a local file. Blank lines and lines
+// starting with # are skipped.
+type File struct {
+	Path string
+}
+
+func (s *File) URLs(ctx context.Context) ([]string, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open URL file: %w", err)
+	}
+	defer f.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read URL file: %w", err)
+	}
+	return urls, nil
+}
+
+// download fetches a sitemap or feed, decompressing gzipped bodies
+func download(ctx context.Context, docURL string, client *http.Client, opts fetch.Options) ([]byte, error) {
+	resp, _, err := fetch.Get(ctx, docURL, client, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", docURL, err)
+	}
+
+	// sitemap.xml.gz is usually served as application/gzip rather than with
+	// a Content-Encoding the transport would undo
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", docURL, err)
+		}
+		defer zr.Close()
+		if body, err = io.ReadAll(io.LimitReader(zr, maxDocumentSize)); err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", docURL, err)
+		}
+	}
+	return body, nil
+}
+
+// resolve makes link absolute against base, returning "" for links that
+// aren't http(s)
+func resolve(base *url.URL, link string) string {
+	u, err := base.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
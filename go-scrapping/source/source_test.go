@@ -0,0 +1,131 @@
+package source
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSitemapFollowsIndex(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>` + srv.URL + `/posts.xml</loc></sitemap>
+  <sitemap><loc>/pages.xml.gz</loc></sitemap>
+</sitemapindex>`))
+	})
+	mux.HandleFunc("/posts.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>` + srv.URL + `/posts/1</loc><lastmod>2024-08-01</lastmod></url>
+  <url><loc> ` + srv.URL + `/posts/2 </loc></url>
+</urlset>`))
+	})
+	mux.HandleFunc("/pages.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(gzipped(t, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>`+srv.URL+`/about</loc></url>
+</urlset>`))
+	})
+
+	s := &Sitemap{URL: srv.URL + "/sitemap.xml", Client: srv.Client(), Options: fetch.Options{}}
+	got, err := s.URLs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{srv.URL + "/posts/1", srv.URL + "/posts/2", srv.URL + "/about"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name string
+		feed string
+		want []string
+	}{
+		{
+			name: "rss 2.0",
+			feed: `<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>
+  <atom:link href="https://example.com/rss" rel="self"/>
+  <item><title>One</title><link>https://example.com/one</link></item>
+  <item><title>Two</title><atom:link href="https://example.com/two.json" rel="alternate"/><link>https://example.com/two</link></item>
+  <item><title>Permalink only</title><guid>https://example.com/three</guid></item>
+  <item><title>Opaque guid</title><guid isPermaLink="false">https://example.com/four</guid></item>
+</channel></rss>`,
+			want: []string{"https://example.com/one", "https://example.com/two", "https://example.com/three"},
+		},
+		{
+			name: "rss 1.0",
+			feed: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+  <channel><link>https://example.com/</link></channel>
+  <item><link>https://example.com/one</link></item>
+</rdf:RDF>`,
+			want: []string{"https://example.com/one"},
+		},
+		{
+			name: "atom",
+			feed: `<feed xmlns="http://www.w3.org/2005/Atom">
+  <link href="https://example.com/" rel="alternate"/>
+  <entry><link rel="replies" href="https://example.com/one#comments"/><link href="https://example.com/one"/></entry>
+  <entry><link rel="alternate" type="text/html" href="/two"/></entry>
+</feed>`,
+			want: []string{"https://example.com/one", "/two"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFeed([]byte(tt.feed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseFeed([]byte(`<html><body>not a feed</body></html>`)); err == nil {
+		t.Error("parsed an HTML page as a feed")
+	}
+}
+
+func TestFileSkipsCommentsAndBlankLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	data := "# tracked pages\nhttps://example.com/a\n\n  https://example.com/b  \n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := (&File{Path: path}).URLs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://example.com/a", "https://example.com/b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+	"github.com/NoxturneDev/hn-scrapper/source"
+	"github.com/NoxturneDev/hn-scrapper/store"
+)
+
+func (s SourceConfig) validate() error {
+	set := 0
+	for _, location := range []string{s.Sitemap, s.Feed, s.File} {
+		if location != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("set exactly one of sitemap, feed or file")
+	}
+	if s.Match != "" {
+		if _, err := regexp.Compile(s.Match); err != nil {
+			return fmt.Errorf("invalid match pattern: %w", err)
+		}
+	}
+	if s.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+// String names the source in logs
+func (s SourceConfig) String() string {
+	switch {
+	case s.Sitemap != "":
+		return "sitemap " + s.Sitemap
+	case s.Feed != "":
+		return "feed " + s.Feed
+	default:
+		return "file " + s.File
+	}
+}
+
+func (s SourceConfig) source(client *http.Client, opts fetch.Options) source.Source {
+	switch {
+	case s.Sitemap != "":
+		return &source.Sitemap{URL: s.Sitemap, Client: client, Options: opts}
+	case s.Feed != "":
+		return &source.Feed{URL: s.Feed, Client: client, Options: opts}
+	default:
+		return &source.File{Path: s.File}
+	}
+}
+
+// urls lists the source's URLs, applying Match and Limit
+func (s SourceConfig) urls(ctx context.Context, client *http.Client, opts fetch.Options) ([]string, error) {
+	urls, err := s.source(client, opts).URLs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.Match != "" {
+		match := regexp.MustCompile(s.Match)
+		kept := urls[:0]
+		for _, u := range urls {
+			if match.MatchString(u) {
+				kept = append(kept, u)
+			}
+		}
+		urls = kept
+	}
+	if s.Limit > 0 && len(urls) > s.Limit {
+		urls = urls[:s.Limit]
+	}
+	return urls, nil
+}
+
+// siteURLs returns a site's seed and pagination pages followed by the pages
+// listed by its sources, without duplicates. Source pages on hosts the site's
+// selectors don't cover are dropped, and a source that fails is logged and
+// skipped so the rest of the site still gets scraped.
+func siteURLs(ctx context.Context, site SiteConfig, client *http.Client, opts fetch.Options, logger *slog.Logger) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	add := func(u string) {
+		key := store.NormalizeURL(u)
+		if !seen[key] {
+			seen[key] = true
+			urls = append(urls, u)
+		}
+	}
+
+	for _, u := range site.pageURLs() {
+		add(u)
+	}
+	if len(site.Sources) == 0 {
+		return urls
+	}
+
+	hosts := make(map[string]bool)
+	for _, host := range site.hostsFor() {
+		hosts[strings.ToLower(host)] = true
+	}
+	for _, src := range site.Sources {
+		listed, err := src.urls(ctx, client, opts)
+		if err != nil {
+			logger.Error("Failed to list URLs from source", "site", site.Name, "source", src.String(), "error", err)
+			continue
+		}
+
+		dropped := 0
+		for _, u := range listed {
+			parsed, err := url.Parse(u)
+			if err != nil || !hosts[strings.ToLower(parsed.Hostname())] {
+				dropped++
+				continue
+			}
+			add(u)
+		}
+		if dropped > 0 {
+			logger.Warn("Dropped source URLs outside the site's hosts", "site", site.Name, "source", src.String(), "count", dropped)
+		}
+		logger.Info("Listed URLs from source", "site", site.Name, "source", src.String(), "url_count", len(listed)-dropped)
+	}
+	return urls
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	"github.com/NoxturneDev/hn-scrapper/fetch"
+)
+
+func TestSiteURLsMergesSources(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rss":
+			io.WriteString(w, `<rss version="2.0"><channel>
+  <item><link>`+srv.URL+`/</link></item>
+  <item><link>`+srv.URL+`/posts/1</link></item>
+  <item><link>`+srv.URL+`/about</link></item>
+  <item><link>https://elsewhere.example/story</link></item>
+</channel></rss>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	site := SiteConfig{
+		Name:  "blog",
+		Seeds: []string{srv.URL + "/"},
+		Sources: []SourceConfig{
+			{Feed: srv.URL + "/rss"},
+			{Sitemap: srv.URL + "/missing.xml"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	got := siteURLs(context.Background(), site, srv.Client(), fetch.Options{}, logger)
+	want := []string{srv.URL + "/", srv.URL + "/posts/1", srv.URL + "/about"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("siteURLs() = %v, want %v", got, want)
+	}
+
+	site.Sources = []SourceConfig{{Feed: srv.URL + "/rss", Match: `/posts/`, Limit: 1}}
+	got = siteURLs(context.Background(), site, srv.Client(), fetch.Options{}, logger)
+	want = []string{srv.URL + "/", srv.URL + "/posts/1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with match: siteURLs() = %v, want %v", got, want)
+	}
+}
+
+func TestSourceConfigValidate(t *testing.T) {
+	tests := []struct {
+		src SourceConfig
+		ok  bool
+	}{
+		{SourceConfig{Sitemap: "https://example.com/sitemap.xml"}, true},
+		{SourceConfig{File: "urls.txt", Match: `^https://`}, true},
+		{SourceConfig{}, false},
+		{SourceConfig{Sitemap: "https://example.com/sitemap.xml", Feed: "https://example.com/rss"}, false},
+		{SourceConfig{Feed: "https://example.com/rss", Match: "("}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.src.validate(); (err == nil) != tt.ok {
+			t.Errorf("validate(%+v) = %v, want ok=%v", tt.src, err, tt.ok)
+		}
+	}
+}
+
+func TestSitesConfigRequiresHostsForFileSources(t *testing.T) {
+	site := SiteConfig{
+		Name:      "blog",
+		Selectors: extract.Selectors{Item: "article"},
+		Sources:   []SourceConfig{{File: "urls.txt"}},
+	}
+	if err := (SitesConfig{Sites: []SiteConfig{site}}).validate(); err == nil {
+		t.Error("accepted a file-only site without hosts")
+	}
+
+	site.Hosts = []string{"blog.example"}
+	if err := (SitesConfig{Sites: []SiteConfig{site}}).validate(); err != nil {
+		t.Errorf("file-only site with hosts: %v", err)
+	}
+}
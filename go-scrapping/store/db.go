@@ -0,0 +1,165 @@
+// Package store owns the SQLite schema and the output sinks scraped items
+// are written to
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// MemoryPath opens an in-memory database
+const MemoryPath = ":memory:"
+
+// TimeLayout matches how SQLite's CURRENT_TIMESTAMP stores datetimes
+const TimeLayout = "2006-01-02 15:04:05"
+
+// Open opens the SQLite database at dbPath. ":memory:" opens a private
+// in-memory database, used by tests.
+func Open(dbPath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Set connection pool parameters. Every connection to :memory: gets its
+	// own empty database, so an in-memory one must stay on one connection.
+	if dbPath == MemoryPath {
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+	} else {
+		db.SetMaxOpenConns(25)
+		db.SetMaxIdleConns(25)
+		db.SetConnMaxLifetime(5 * time.Minute)
+	}
+
+	// Verify database connection
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, nil
+}
+
+// dedupTitles adds the dedup columns to the titles table, backfills url_key
+// and folds duplicate rows into one row per normalized URL, keeping the
+// oldest id, the most recent title and the first/last time the URL was seen.
+// Databases created by older versions may already have the columns.
+func dedupTitles(tx *sql.Tx) error {
+	columns, err := tableColumns(tx, "titles")
+	if err != nil {
+		return err
+	}
+
+	for _, col := range []string{"url_key TEXT", "first_seen_at DATETIME", "last_seen_at DATETIME"} {
+		name := strings.Fields(col)[0]
+		if columns[name] {
+			continue
+		}
+		if _, err := tx.Exec("ALTER TABLE titles ADD COLUMN " + col); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", name, err)
+		}
+	}
+
+	// Backfill url_key in Go since normalization isn't expressible in SQL
+	rows, err := tx.Query("SELECT id, url FROM titles WHERE url_key IS NULL")
+	if err != nil {
+		return err
+	}
+	keys := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var rawURL string
+		if err := rows.Scan(&id, &rawURL); err != nil {
+			rows.Close()
+			return err
+		}
+		keys[id] = NormalizeURL(rawURL)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		if err := mergeDuplicateTitles(tx, keys); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_titles_url_key ON titles(url_key)")
+	if err != nil {
+		return fmt.Errorf("failed to create url_key index: %w", err)
+	}
+	return nil
+}
+
+// undoDedupTitles drops the dedup columns. Merged duplicates stay merged.
+func undoDedupTitles(tx *sql.Tx) error {
+	if _, err := tx.Exec("DROP INDEX IF EXISTS idx_titles_url_key"); err != nil {
+		return err
+	}
+	for _, col := range []string{"url_key", "first_seen_at", "last_seen_at"} {
+		if _, err := tx.Exec("ALTER TABLE titles DROP COLUMN " + col); err != nil {
+			return fmt.Errorf("failed to drop column %s: %w", col, err)
+		}
+	}
+	return nil
+}
+
+// mergeDuplicateTitles stores the backfilled url_keys and collapses rows
+// sharing one
+func mergeDuplicateTitles(tx *sql.Tx, keys map[int64]string) error {
+	update, err := tx.Prepare("UPDATE titles SET url_key = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer update.Close()
+	for id, key := range keys {
+		if _, err := update.Exec(key, id); err != nil {
+			return err
+		}
+	}
+
+	// Collapse duplicates onto the oldest row of each url_key
+	_, err = tx.Exec(`UPDATE titles SET
+		first_seen_at = (SELECT MIN(COALESCE(t.first_seen_at, t.created_at)) FROM titles t WHERE t.url_key = titles.url_key),
+		last_seen_at = (SELECT MAX(COALESCE(t.last_seen_at, t.created_at)) FROM titles t WHERE t.url_key = titles.url_key),
+		title = (SELECT t.title FROM titles t WHERE t.url_key = titles.url_key ORDER BY t.id DESC LIMIT 1)
+	WHERE id IN (SELECT MIN(id) FROM titles GROUP BY url_key)`)
+	if err != nil {
+		return fmt.Errorf("failed to merge duplicate titles: %w", err)
+	}
+	_, err = tx.Exec("DELETE FROM titles WHERE id NOT IN (SELECT MIN(id) FROM titles GROUP BY url_key)")
+	if err != nil {
+		return fmt.Errorf("failed to delete duplicate titles: %w", err)
+	}
+	return nil
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// tableColumns returns the set of column names of a table
+func tableColumns(db querier, table string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
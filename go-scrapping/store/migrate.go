@@ -0,0 +1,261 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Migrations live in migrations/ as NNNN_name.up.sql and NNNN_name.down.sql.
+// Steps that need Go, like backfilling normalized URLs, are in goMigrations.
+// Early migrations use IF NOT EXISTS so databases created before migrations
+// existed are adopted without errors.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// goMigrations are the migrations written in Go
+var goMigrations = []Migration{
+	{Version: 2, Name: "dedup_titles", up: dedupTitles, down: undoDedupTitles},
+	{Version: 10, Name: "create_search_index", up: createSearchIndex, down: dropSearchIndex},
+}
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+
+	up, down func(tx *sql.Tx) error
+}
+
+// MigrationStatus reports whether a migration is applied to a database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt string // empty when not applied
+}
+
+// Migrations returns every known migration in version order
+func Migrations() ([]Migration, error) {
+	byVersion := make(map[int]*Migration)
+	for _, m := range goMigrations {
+		byVersion[m.Version] = &m
+	}
+
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = execSQL(string(data))
+		} else {
+			m.down = execSQL(string(data))
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == nil || m.down == nil {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down step", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func execSQL(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// Migrate applies every pending migration and fits the search index to this
+// build. The scraper and its subcommands call it on startup.
+func Migrate(db *sql.DB) error {
+	if _, err := MigrateUp(db, 0); err != nil {
+		return err
+	}
+	_, err := EnsureSearchIndex(db)
+	return err
+}
+
+// MigrateUp applies pending migrations up to and including version to, or
+// all of them when to is 0, and returns the ones it applied
+func MigrateUp(db *sql.DB, to int) ([]Migration, error) {
+	migrations, applied, err := loadMigrationState(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if to > 0 && m.Version > to {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := runMigration(db, m, true); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back applied migrations newer than version to, latest
+// first, and returns the ones it rolled back
+func MigrateDown(db *sql.DB, to int) ([]Migration, error) {
+	migrations, applied, err := loadMigrationState(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= to {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := runMigration(db, m, false); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// CurrentVersion returns the latest applied migration, 0 for a new database
+func CurrentVersion(db *sql.DB) (int, error) {
+	if err := createMigrationsTable(db); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrationStatuses lists every known migration and whether it is applied
+func MigrationStatuses(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, applied, err := loadMigrationState(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses[i] = MigrationStatus{Migration: m, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+func createMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// loadMigrationState returns the known migrations and the applied versions
+// with the time each was applied. A database migrated by a newer build is
+// an error rather than something to guess about.
+func loadMigrationState(db *sql.DB) ([]Migration, map[int]string, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := createMigrationsTable(db); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var appliedAt sql.NullString
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, nil, err
+		}
+		if !known[version] {
+			return nil, nil, fmt.Errorf("database has migration %d applied, which this build doesn't know; use a newer scraper", version)
+		}
+		applied[version] = appliedAt.String
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return migrations, applied, nil
+}
+
+// runMigration applies or rolls back one migration and records it in
+// schema_migrations in the same transaction
+func runMigration(db *sql.DB, m Migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		if err := m.up(tx); err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+	} else {
+		if err := m.down(tx); err != nil {
+			return fmt.Errorf("failed to roll back migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,105 @@
+package store
+
+import "testing"
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	db, err := Open(MemoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := CurrentVersion(db); err != nil || v != latest {
+		t.Fatalf("version = %d, %v; want %d", v, err, latest)
+	}
+
+	// Rolling everything back leaves only the bookkeeping table
+	rolledBack, err := MigrateDown(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolledBack) != len(migrations) {
+		t.Errorf("rolled back %d migrations, want %d", len(rolledBack), len(migrations))
+	}
+	var tables int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')").Scan(&tables)
+	if tables != 0 {
+		t.Errorf("%d tables left after rolling back every migration", tables)
+	}
+
+	// And every down step is reversible
+	applied, err := MigrateUp(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+}
+
+func TestMigrateAdoptsLegacyDatabase(t *testing.T) {
+	db, err := Open(MemoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The schema of databases written before deduplication and migrations
+	_, err = db.Exec(`CREATE TABLE titles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		url TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO titles (title, url) VALUES
+		('Old title', 'https://example.com/a?utm_source=hn'),
+		('New title', 'https://example.com/a'),
+		('Other', 'https://example.com/b');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM titles").Scan(&n)
+	if n != 2 {
+		t.Errorf("%d titles after migrating, want duplicates merged into 2", n)
+	}
+	var title string
+	db.QueryRow("SELECT title FROM titles WHERE url_key = ?", NormalizeURL("https://example.com/a")).Scan(&title)
+	if title != "New title" {
+		t.Errorf("merged title = %q, want the most recent one", title)
+	}
+
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("migration %d_%s not applied", s.Version, s.Name)
+		}
+	}
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name) VALUES (9999, 'from_the_future')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err == nil {
+		t.Error("migrated a database with an unknown newer migration applied")
+	}
+}
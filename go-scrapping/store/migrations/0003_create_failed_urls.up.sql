@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS failed_urls (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL UNIQUE,
+	error TEXT NOT NULL,
+	status_code INTEGER,
+	attempts INTEGER NOT NULL,
+	failed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS crawl_queue (
+	url_key TEXT PRIMARY KEY,
+	url TEXT NOT NULL,
+	depth INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_crawl_queue_status ON crawl_queue(status);
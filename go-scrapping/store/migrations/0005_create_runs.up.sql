@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at DATETIME NOT NULL,
+	finished_at DATETIME,
+	sites TEXT NOT NULL,
+	status TEXT NOT NULL,
+	items INTEGER NOT NULL DEFAULT 0,
+	errors INTEGER NOT NULL DEFAULT 0,
+	pages_done INTEGER NOT NULL DEFAULT 0,
+	pages_failed INTEGER NOT NULL DEFAULT 0,
+	error TEXT
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS snapshots (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	site TEXT,
+	item_id TEXT,
+	url_key TEXT NOT NULL,
+	title TEXT NOT NULL,
+	url TEXT NOT NULL,
+	rank INTEGER NOT NULL,
+	points INTEGER NOT NULL DEFAULT 0,
+	comments INTEGER NOT NULL DEFAULT 0,
+	captured_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_snapshots_run ON snapshots(run_id);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS articles (
+	url_key TEXT PRIMARY KEY REFERENCES titles(url_key),
+	url TEXT NOT NULL,
+	final_url TEXT,
+	title TEXT,
+	author TEXT,
+	published_at TEXT,
+	description TEXT,
+	site_name TEXT,
+	image TEXT,
+	content TEXT,
+	word_count INTEGER NOT NULL DEFAULT 0,
+	meta TEXT,
+	error TEXT,
+	fetched_at DATETIME NOT NULL
+);
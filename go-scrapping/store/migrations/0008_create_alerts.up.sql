@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS alerts (
+	url_key TEXT PRIMARY KEY,
+	rule TEXT NOT NULL,
+	site TEXT,
+	title TEXT,
+	url TEXT NOT NULL,
+	alerted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE titles DROP COLUMN fields;
@@ -0,0 +1 @@
+ALTER TABLE titles ADD COLUMN fields TEXT;
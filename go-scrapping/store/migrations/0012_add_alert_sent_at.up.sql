@@ -0,0 +1,2 @@
+ALTER TABLE alerts ADD COLUMN sent_at DATETIME;
+UPDATE alerts SET sent_at = alerted_at;
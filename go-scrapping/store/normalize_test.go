@@ -0,0 +1,21 @@
+package store
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"HTTPS://Example.COM:443/a/?utm_source=hn&b=2&a=1#top", "https://example.com/a?a=1&b=2"},
+		{"http://example.com:8080", "http://example.com:8080/"},
+		{"http://[::1]:8080/a", "http://[::1]:8080/a"},
+		{"http://[::1]:80/", "http://[::1]/"},
+		{"https://[2001:DB8::1]/x/", "https://[2001:db8::1]/x"},
+		{"  not a url ", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeURL(tt.raw); got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
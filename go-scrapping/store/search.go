@@ -0,0 +1,109 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// The search index is an FTS5 table over titles, kept in sync by triggers.
+// FTS5 is only compiled into builds with -tags sqlite_fts5 (see the
+// Makefile); other builds search with LIKE instead. The triggers can't run
+// without FTS5, so they aren't part of the shared schema: every build adds
+// or drops them on startup, see EnsureSearchIndex.
+const searchIndexSQL = `
+CREATE VIRTUAL TABLE IF NOT EXISTS titles_fts USING fts5(
+	title, url, content='titles', content_rowid='id'
+);
+CREATE TRIGGER IF NOT EXISTS titles_fts_insert AFTER INSERT ON titles BEGIN
+	INSERT INTO titles_fts(rowid, title, url) VALUES (new.id, new.title, new.url);
+END;
+CREATE TRIGGER IF NOT EXISTS titles_fts_delete AFTER DELETE ON titles BEGIN
+	INSERT INTO titles_fts(titles_fts, rowid, title, url) VALUES ('delete', old.id, old.title, old.url);
+END;
+CREATE TRIGGER IF NOT EXISTS titles_fts_update AFTER UPDATE OF title, url ON titles BEGIN
+	INSERT INTO titles_fts(titles_fts, rowid, title, url) VALUES ('delete', old.id, old.title, old.url);
+	INSERT INTO titles_fts(rowid, title, url) VALUES (new.id, new.title, new.url);
+END;
+INSERT INTO titles_fts(titles_fts) VALUES ('rebuild');`
+
+const dropSearchTriggersSQL = `
+DROP TRIGGER IF EXISTS titles_fts_insert;
+DROP TRIGGER IF EXISTS titles_fts_delete;
+DROP TRIGGER IF EXISTS titles_fts_update;`
+
+// FTS5Available reports whether this build's SQLite has FTS5
+func FTS5Available(db querier) (bool, error) {
+	var enabled bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return false, fmt.Errorf("failed to check for FTS5: %w", err)
+	}
+	return enabled, nil
+}
+
+// EnsureSearchIndex fits the search index to this build. With FTS5 it
+// creates the index, or rebuilds it when its triggers are missing. Without
+// FTS5 it drops the triggers a build with FTS5 left behind, since they would
+// make every write to titles fail; the index table itself can't be dropped
+// without FTS5 and is rebuilt when a build with FTS5 next opens the
+// database. It reports whether titles can be searched with FTS5.
+func EnsureSearchIndex(db *sql.DB) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	available, err := syncSearchIndex(tx)
+	if err != nil {
+		return false, err
+	}
+	return available, tx.Commit()
+}
+
+func syncSearchIndex(tx *sql.Tx) (bool, error) {
+	available, err := FTS5Available(tx)
+	if err != nil {
+		return false, err
+	}
+	if !available {
+		if _, err := tx.Exec(dropSearchTriggersSQL); err != nil {
+			return false, fmt.Errorf("failed to drop search index triggers: %w", err)
+		}
+		return false, nil
+	}
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'titles_fts_update')").Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up search index: %w", err)
+	}
+	if exists {
+		return true, nil
+	}
+	if _, err := tx.Exec(searchIndexSQL); err != nil {
+		return false, fmt.Errorf("failed to create search index: %w", err)
+	}
+	return true, nil
+}
+
+// createSearchIndex is migration 10
+func createSearchIndex(tx *sql.Tx) error {
+	_, err := syncSearchIndex(tx)
+	return err
+}
+
+// dropSearchIndex rolls back migration 10. Without FTS5 only the triggers
+// can be dropped.
+func dropSearchIndex(tx *sql.Tx) error {
+	available, err := FTS5Available(tx)
+	if err != nil {
+		return err
+	}
+	query := dropSearchTriggersSQL
+	if available {
+		query += "\nDROP TABLE IF EXISTS titles_fts;"
+	}
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to drop search index: %w", err)
+	}
+	return nil
+}
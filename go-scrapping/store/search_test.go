@@ -0,0 +1,72 @@
+package store
+
+import "testing"
+
+func searchTriggers(t *testing.T, db querier) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'titles_fts_%'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestEnsureSearchIndexAddsTriggersWithFTS5(t *testing.T) {
+	db := newTestDB(t)
+	if available, _ := FTS5Available(db); !available {
+		t.Skip("needs -tags sqlite_fts5")
+	}
+	if n := searchTriggers(t, db); n != 3 {
+		t.Fatalf("%d search triggers after migrating, want 3", n)
+	}
+
+	// A build without FTS5 dropped the triggers, then saved a title
+	if _, err := db.Exec(dropSearchTriggersSQL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO titles (title, url, url_key) VALUES ('Unindexed title', 'https://example.com/a', 'https://example.com/a')"); err != nil {
+		t.Fatal(err)
+	}
+
+	fts, err := EnsureSearchIndex(db)
+	if err != nil || !fts {
+		t.Fatalf("EnsureSearchIndex() = %v, %v; want true", fts, err)
+	}
+	if n := searchTriggers(t, db); n != 3 {
+		t.Errorf("%d search triggers, want 3", n)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM titles_fts WHERE titles_fts MATCH 'unindexed'").Scan(&n); err != nil || n != 1 {
+		t.Errorf("index has %d matches for a title saved without triggers, %v; want it rebuilt", n, err)
+	}
+}
+
+func TestEnsureSearchIndexDropsTriggersWithoutFTS5(t *testing.T) {
+	db := newTestDB(t)
+	if available, _ := FTS5Available(db); available {
+		t.Skip("needs a build without -tags sqlite_fts5")
+	}
+
+	// Stand-ins for the triggers a build with FTS5 leaves behind, failing
+	// like the real ones do here
+	_, err := db.Exec(`CREATE TRIGGER titles_fts_insert AFTER INSERT ON titles BEGIN
+			SELECT RAISE(ABORT, 'no such module: fts5');
+		END;
+		CREATE TRIGGER titles_fts_update AFTER UPDATE OF title, url ON titles BEGIN
+			SELECT RAISE(ABORT, 'no such module: fts5');
+		END;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fts, err := EnsureSearchIndex(db)
+	if err != nil || fts {
+		t.Fatalf("EnsureSearchIndex() = %v, %v; want false", fts, err)
+	}
+	if n := searchTriggers(t, db); n != 0 {
+		t.Errorf("%d search triggers left", n)
+	}
+	if _, err := db.Exec("INSERT INTO titles (title, url, url_key) VALUES ('Title', 'https://example.com/a', 'https://example.com/a')"); err != nil {
+		t.Errorf("saving a title failed: %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+	_ "github.com/lib/pq"
+)
+
+// Sink receives scraped items in batches. Implementations should write a
+// batch atomically where the backend allows it. They don't need to be safe
+// for concurrent use; the DB writer goroutine is the only caller.
+type Sink interface {
+	WriteBatch(items []extract.Item) error
+	Close() error
+}
+
+// OpenSinks builds a sink for each -output spec and fans out to all of them.
+// Specs are "sqlite", "stdout", "csv:PATH", "jsonl:PATH" or "postgres:DSN".
+func OpenSinks(specs []string, db *sql.DB, runID int64) (Sink, error) {
+	if len(specs) == 0 {
+		specs = []string{"sqlite"}
+	}
+
+	var sinks MultiSink
+	for _, spec := range specs {
+		sink, err := openSink(spec, db, runID)
+		if err != nil {
+			sinks.Close()
+			return nil, fmt.Errorf("output %q: %w", spec, err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
+
+func openSink(spec string, db *sql.DB, runID int64) (Sink, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "sqlite":
+		return newSQLiteSink(db, runID)
+	case "stdout":
+		return newJSONLSink(nopCloser{os.Stdout}), nil
+	case "csv", "jsonl":
+		if arg == "" {
+			return nil, fmt.Errorf("missing file path")
+		}
+		f, err := os.OpenFile(arg, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		if kind == "jsonl" {
+			return newJSONLSink(f), nil
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return newCSVSink(f, info.Size() == 0)
+	case "postgres":
+		if arg == "" {
+			return nil, fmt.Errorf("missing connection string")
+		}
+		return newPostgresSink(arg)
+	default:
+		return nil, fmt.Errorf("unknown output type %q", kind)
+	}
+}
+
+// MultiSink writes every item to all of its sinks
+type MultiSink []Sink
+
+func (m MultiSink) WriteBatch(items []extract.Item) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.WriteBatch(items); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m MultiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sqliteSink upserts items into the titles table, one transaction per batch.
+// Per-site fields are stored as a JSON object. With a run id it also
+// records a snapshot of every ranked item.
+type sqliteSink struct {
+	db       *sql.DB
+	stmt     *sql.Stmt
+	runID    int64
+	snapshot *sql.Stmt
+}
+
+func newSQLiteSink(db *sql.DB, runID int64) (*sqliteSink, error) {
+	// Upsert on the normalized URL so re-scraped stories update in place
+	stmt, err := db.Prepare(`INSERT INTO titles (title, url, url_key, fields, first_seen_at, last_seen_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(url_key) DO UPDATE SET
+			title = excluded.title,
+			fields = excluded.fields,
+			last_seen_at = excluded.last_seen_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	s := &sqliteSink{db: db, stmt: stmt, runID: runID}
+
+	if runID != 0 {
+		s.snapshot, err = db.Prepare(`INSERT INTO snapshots
+			(run_id, site, item_id, url_key, title, url, rank, points, comments)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			stmt.Close()
+			return nil, fmt.Errorf("failed to prepare snapshot statement: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *sqliteSink) WriteBatch(items []extract.Item) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt := tx.Stmt(s.stmt)
+	defer stmt.Close()
+	for _, item := range items {
+		if err := insertTitle(stmt, item); err != nil {
+			return err
+		}
+	}
+
+	if s.snapshot != nil {
+		snapshot := tx.Stmt(s.snapshot)
+		defer snapshot.Close()
+		for _, item := range items {
+			if item.Rank == 0 {
+				continue
+			}
+			_, err := snapshot.Exec(s.runID, item.Site, item.ItemID, NormalizeURL(item.URL),
+				item.Title, item.URL, item.Rank, item.Points, item.Comments)
+			if err != nil {
+				return fmt.Errorf("failed to insert snapshot: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit batch: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteSink) Close() error {
+	if s.snapshot != nil {
+		s.snapshot.Close()
+	}
+	return s.stmt.Close()
+}
+
+// csvSink appends items as site,title,url,scraped_at rows
+type csvSink struct {
+	file io.WriteCloser
+	w    *csv.Writer
+}
+
+func newCSVSink(file io.WriteCloser, writeHeader bool) (*csvSink, error) {
+	s := &csvSink{file: file, w: csv.NewWriter(file)}
+	if writeHeader {
+		if err := s.w.Write([]string{"site", "title", "url", "scraped_at"}); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *csvSink) WriteBatch(items []extract.Item) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, item := range items {
+		if err := s.w.Write([]string{item.Site, item.Title, item.URL, now}); err != nil {
+			return err
+		}
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *csvSink) Close() error {
+	s.w.Flush()
+	if err := s.w.Error(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// jsonlSink writes one JSON object per item and line
+type jsonlSink struct {
+	file io.WriteCloser
+	enc  *json.Encoder
+}
+
+type jsonlRecord struct {
+	Site      string            `json:"site,omitempty"`
+	Title     string            `json:"title"`
+	URL       string            `json:"url"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	ItemID    string            `json:"item_id,omitempty"`
+	Rank      int               `json:"rank,omitempty"`
+	Points    int               `json:"points,omitempty"`
+	Comments  int               `json:"comments,omitempty"`
+	ScrapedAt time.Time         `json:"scraped_at"`
+}
+
+func newJSONLSink(file io.WriteCloser) *jsonlSink {
+	return &jsonlSink{file: file, enc: json.NewEncoder(file)}
+}
+
+func (s *jsonlSink) WriteBatch(items []extract.Item) error {
+	now := time.Now().UTC()
+	for _, item := range items {
+		err := s.enc.Encode(jsonlRecord{
+			Site:      item.Site,
+			Title:     item.Title,
+			URL:       item.URL,
+			Fields:    item.Fields,
+			ItemID:    item.ItemID,
+			Rank:      item.Rank,
+			Points:    item.Points,
+			Comments:  item.Comments,
+			ScrapedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonlSink) Close() error {
+	return s.file.Close()
+}
+
+// nopCloser keeps stdout open when its sink is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// postgresSink upserts items into a titles table in PostgreSQL with the same
+// dedup semantics as the SQLite schema
+type postgresSink struct {
+	db   *sql.DB
+	stmt *sql.Stmt
+}
+
+func newPostgresSink(dsn string) (*postgresSink, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping postgres: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS titles (
+		id BIGSERIAL PRIMARY KEY,
+		site TEXT,
+		title TEXT NOT NULL,
+		url TEXT NOT NULL,
+		url_key TEXT NOT NULL UNIQUE,
+		fields JSONB,
+		first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create postgres table: %w", err)
+	}
+
+	stmt, err := db.Prepare(`INSERT INTO titles (site, title, url, url_key, fields)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (url_key) DO UPDATE SET
+			title = EXCLUDED.title,
+			fields = EXCLUDED.fields,
+			last_seen_at = now()`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare postgres statement: %w", err)
+	}
+	return &postgresSink{db: db, stmt: stmt}, nil
+}
+
+func (s *postgresSink) WriteBatch(items []extract.Item) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin postgres transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt := tx.Stmt(s.stmt)
+	defer stmt.Close()
+	for _, item := range items {
+		fields, err := fieldsJSON(item)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(item.Site, item.Title, item.URL, NormalizeURL(item.URL), fields); err != nil {
+			return fmt.Errorf("failed to insert into postgres: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit postgres batch: %w", err)
+	}
+	return nil
+}
+
+func (s *postgresSink) Close() error {
+	s.stmt.Close()
+	return s.db.Close()
+}
+
+// fieldsJSON encodes an item's per-site fields for a JSON column, nil when
+// there are none. It's a string since lib/pq would send []byte as bytea.
+func fieldsJSON(item extract.Item) (any, error) {
+	if len(item.Fields) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(item.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode fields: %w", err)
+	}
+	return string(data), nil
+}
+
+// Insert or refresh a scraped title in the SQLite DB
+func insertTitle(stmt *sql.Stmt, item extract.Item) error {
+	fields, err := fieldsJSON(item)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(item.Title, item.URL, NormalizeURL(item.URL), fields)
+	if err != nil {
+		return fmt.Errorf("failed to insert title: %w", err)
+	}
+	return nil
+}
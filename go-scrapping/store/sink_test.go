@@ -0,0 +1,141 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/NoxturneDev/hn-scrapper/extract"
+)
+
+func newTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	db, err := Open(MemoryPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	if err := Migrate(db); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+func newBenchSink(b *testing.B) *sqliteSink {
+	b.Helper()
+
+	sink, err := newSQLiteSink(newTestDB(b), 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+func benchItems(n int) []extract.Item {
+	items := make([]extract.Item, n)
+	for i := range items {
+		items[i] = extract.Item{
+			Title: fmt.Sprintf("Story %d", i),
+			URL:   fmt.Sprintf("https://example.com/story/%d", i),
+		}
+	}
+	return items
+}
+
+// BenchmarkInsertPerRow is the old writer path: one autocommit Exec per item
+func BenchmarkInsertPerRow(b *testing.B) {
+	sink := newBenchSink(b)
+	items := benchItems(b.N)
+
+	b.ResetTimer()
+	for _, item := range items {
+		if err := insertTitle(sink.stmt, item); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSQLiteSinkBatched(b *testing.B) {
+	for _, size := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			sink := newBenchSink(b)
+			items := benchItems(b.N)
+
+			b.ResetTimer()
+			for start := 0; start < len(items); start += size {
+				end := min(start+size, len(items))
+				if err := sink.WriteBatch(items[start:end]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteSinkStoresFields(t *testing.T) {
+	db := newTestDB(t)
+	sink, err := newSQLiteSink(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	err = sink.WriteBatch([]extract.Item{
+		{Title: "With fields", URL: "https://example.com/a", Fields: map[string]string{"author": "pg", "age": "2 hours ago"}},
+		{Title: "Without fields", URL: "https://example.com/b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields sql.NullString
+	db.QueryRow("SELECT fields FROM titles WHERE url = ?", "https://example.com/a").Scan(&fields)
+	if fields.String != `{"age":"2 hours ago","author":"pg"}` {
+		t.Errorf("fields = %q, want both fields as JSON", fields.String)
+	}
+	db.QueryRow("SELECT fields FROM titles WHERE url = ?", "https://example.com/b").Scan(&fields)
+	if fields.Valid {
+		t.Errorf("fields = %q, want NULL for an item without fields", fields.String)
+	}
+}
+
+func TestSQLiteSinkUpdatesRescrapedURL(t *testing.T) {
+	db := newTestDB(t)
+	sink, err := newSQLiteSink(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.WriteBatch([]extract.Item{{Title: "Old title", URL: "https://Example.com/a/?utm_source=hn"}}); err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	db.QueryRow("SELECT id FROM titles").Scan(&id)
+	// Backdate the row so the update shows in last_seen_at, which has
+	// second precision
+	db.Exec("UPDATE titles SET first_seen_at = datetime('now', '-1 hour'), last_seen_at = datetime('now', '-1 hour')")
+
+	// The same story under another spelling of its URL
+	if err := sink.WriteBatch([]extract.Item{{Title: "New title", URL: "https://example.com/a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM titles").Scan(&n)
+	if n != 1 {
+		t.Fatalf("%d rows after re-scraping the same URL, want 1", n)
+	}
+	var gotID int64
+	var title string
+	var updated bool
+	err = db.QueryRow("SELECT id, title, last_seen_at > first_seen_at FROM titles").Scan(&gotID, &title, &updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotID != id || title != "New title" || !updated {
+		t.Errorf("row = id %d, %q, last seen later: %v; want id %d updated to the new title", gotID, title, updated, id)
+	}
+}